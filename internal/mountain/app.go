@@ -37,13 +37,20 @@ func init() {
 		},
 		Commands: []*cli.Command{
 			commands.StartCommand(),
+			commands.TokenCommand(),
+			commands.ConfigCommand(),
+			commands.StorageCommand(),
 		},
 		Before:       onBefore,
+		After:        onAfter,
 		Action:       cli.ShowAppHelp,
 		BashComplete: cli.DefaultAppComplete,
 		Reader:       os.Stdin,
 		Writer:       os.Stdout,
 		ErrWriter:    os.Stderr,
+
+		// permissions like rocks:read,put are passed as a single flag value
+		DisableSliceFlagSeparator: true,
 	}
 }
 
@@ -55,24 +62,19 @@ func onBefore(c *cli.Context) error {
 	configPath := c.String("config")
 	var err error
 
-	if configPath != "" {
-		slog.Debug("loading config file", slog.String("path", configPath))
-		if err = config.Load(configPath); err != nil {
+	if configPath == "" {
+		slog.Debug("searching config file at", slog.Any("paths", config.DefaultSearchDirs))
+		if configPath, err = config.Search(config.DefaultSearchDirs...); err != nil {
 			return err
 		}
 
-		return nil
-	}
-
-	slog.Debug("searching config file at", slog.Any("paths", config.DefaultSearchDirs))
-	var p string
-	if p, err = config.Search(config.DefaultSearchDirs...); err != nil {
-		return err
+		slog.Debug("config founded, loading", slog.String("path", configPath))
+	} else {
+		slog.Debug("loading config file", slog.String("path", configPath))
 	}
 
-	slog.Debug("config founded, loading", slog.String("path", p))
-
-	if err = config.Load(p); err != nil {
+	// config commands read a file by themselves and report its problems
+	if err = config.Load(configPath); err != nil && c.Args().First() != "config" {
 		return err
 	}
 
@@ -87,6 +89,11 @@ func onBefore(c *cli.Context) error {
 	return nil
 }
 
+// onAfter - flushes logs, when a command is finished
+func onAfter(_ *cli.Context) error {
+	return logging.Close()
+}
+
 func versionPrinter(ctx *cli.Context) {
 	base := fmt.Sprintf("%s; version %s; ", ctx.App.Name, ctx.App.Version)
 	d, ok := debug.ReadBuildInfo()
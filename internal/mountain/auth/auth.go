@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"lua-mountain/internal/mountain/storage"
+)
+
+const (
+	OpRead   Operation = "read"
+	OpPut    Operation = "put"
+	OpDelete Operation = "delete"
+	// OpAll - wildcard of operations in permissions
+	OpAll Operation = "*"
+
+	// AnyRepository - wildcard of repository prefixes in permissions
+	AnyRepository = "*"
+)
+
+var (
+	// ErrNoCredentials - a request has no credentials, which an authenticator understands
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials - credentials are recognized, but they are wrong or expired
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	Operations = []Operation{OpRead, OpPut, OpDelete}
+)
+
+type (
+	// Operation - kind of repository access: read manifests and files, put or delete files
+	Operation string
+
+	// Permission - allowed operations on a repository, written as "prefix:op1,op2"
+	Permission struct {
+		Repository string
+		Operations []Operation
+	}
+
+	// Principal - authenticated client
+	Principal struct {
+		Name        string
+		Permissions []Permission
+	}
+
+	// Authenticator - checks request credentials. ErrNoCredentials allows other authenticators to check a request
+	Authenticator interface {
+		Authenticate(req *http.Request) (*Principal, error)
+	}
+
+	// Chain - authenticators, which are tried in order until one of them recognizes credentials
+	Chain []Authenticator
+
+	Config struct {
+		// Tokens - hashed api tokens store, managed by "mountain token" commands
+		Tokens *TokensConfig `yaml:"tokens"`
+		// JWT - bearer tokens of an oidc provider, like gitlab or github ci
+		JWT *JWTConfig `yaml:"jwt"`
+		// ClientCerts - permissions of tls client certificates, listen.tls.client_ca_file is required
+		ClientCerts *ClientCertConfig `yaml:"client_certs"`
+	}
+)
+
+// New - builds authenticators by config, nil is returned when authentication is not configured
+func New(ctx context.Context, cfg *Config, storages storage.Storages, logger *slog.Logger) (Authenticator, error) {
+	var chain Chain
+	if cfg.Tokens != nil {
+		tokens, err := NewTokenStore(cfg.Tokens, storages, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, tokens)
+	}
+
+	if cfg.JWT != nil {
+		j, err := NewJWT(ctx, cfg.JWT, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, j)
+	}
+
+	// certificates are checked last, so explicit credentials of a request have a priority
+	if cfg.ClientCerts != nil {
+		cc, err := NewClientCert(cfg.ClientCerts)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, cc)
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	return chain, nil
+}
+
+func (c Chain) Authenticate(req *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		p, err := authenticator.Authenticate(req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return p, err
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// Can - checks, that any principal permission allows an operation on a repository
+func (p *Principal) Can(repository string, op Operation) bool {
+	for _, perm := range p.Permissions {
+		if perm.Allows(repository, op) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows - repository prefixes are compared without slashes, like ParsePermission stores them
+func (perm Permission) Allows(repository string, op Operation) bool {
+	if perm.Repository != AnyRepository && perm.Repository != strings.Trim(repository, "/") {
+		return false
+	}
+
+	return slices.Contains(perm.Operations, op) || slices.Contains(perm.Operations, OpAll)
+}
+
+// ParsePermission - parses "prefix:op1,op2", "*" means any repository or any operation
+func ParsePermission(s string) (Permission, error) {
+	repo, ops, found := strings.Cut(s, ":")
+	repo = strings.Trim(repo, "/ ")
+	if !found || repo == "" || ops == "" {
+		return Permission{}, fmt.Errorf("bad permission %q, expected prefix:op1,op2", s)
+	}
+
+	perm := Permission{Repository: repo}
+	for _, op := range strings.Split(ops, ",") {
+		op := Operation(strings.TrimSpace(op))
+		if op != OpAll && !slices.Contains(Operations, op) {
+			return Permission{}, fmt.Errorf("bad permission %q: unknown operation %q", s, op)
+		}
+
+		perm.Operations = append(perm.Operations, op)
+	}
+
+	return perm, nil
+}
+
+func (perm Permission) String() string {
+	ops := make([]string, 0, len(perm.Operations))
+	for _, op := range perm.Operations {
+		ops = append(ops, string(op))
+	}
+
+	return perm.Repository + ":" + strings.Join(ops, ",")
+}
+
+func (perm Permission) MarshalText() ([]byte, error) {
+	return []byte(perm.String()), nil
+}
+
+func (perm *Permission) UnmarshalText(b []byte) (err error) {
+	*perm, err = ParsePermission(string(b))
+	return
+}
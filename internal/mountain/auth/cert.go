@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type (
+	ClientCertConfig struct {
+		// Rules - certificates get permissions of all matched rules, certificates without matches are rejected
+		Rules []ClientCertRule `yaml:"rules"`
+	}
+
+	// ClientCertRule - subject patterns (path.Match syntax), all set fields must match
+	ClientCertRule struct {
+		CommonName         string       `yaml:"common_name"`
+		Organization       string       `yaml:"organization"`
+		OrganizationalUnit string       `yaml:"organizational_unit"`
+		Permissions        []Permission `yaml:"permissions"`
+	}
+
+	// ClientCert - authenticator of clients by certificates, verified by a server tls config (mutual tls)
+	ClientCert struct {
+		rules []ClientCertRule
+	}
+)
+
+func NewClientCert(cfg *ClientCertConfig) (*ClientCert, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("client certs: rules are required")
+	}
+
+	for i, rule := range cfg.Rules {
+		for _, pattern := range []string{rule.CommonName, rule.Organization, rule.OrganizationalUnit} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("client certs: rule %d: bad pattern %q", i, pattern)
+			}
+		}
+	}
+
+	return &ClientCert{rules: cfg.Rules}, nil
+}
+
+// Authenticate - uses a leaf of a verified chain, unverified certificates are ignored
+func (cc *ClientCert) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cert := req.TLS.VerifiedChains[0][0]
+	p := &Principal{Name: "cert:" + cert.Subject.CommonName}
+	for _, rule := range cc.rules {
+		if rule.Match(cert) {
+			p.Permissions = append(p.Permissions, rule.Permissions...)
+		}
+	}
+
+	if len(p.Permissions) == 0 {
+		return nil, fmt.Errorf("certificate %s does not match any rule: %w", cert.Subject.String(), ErrInvalidCredentials)
+	}
+
+	return p, nil
+}
+
+func (rule *ClientCertRule) Match(cert *x509.Certificate) bool {
+	return matchAny(rule.CommonName, []string{cert.Subject.CommonName}) &&
+		matchAny(rule.Organization, cert.Subject.Organization) &&
+		matchAny(rule.OrganizationalUnit, cert.Subject.OrganizationalUnit)
+}
+
+// matchAny - an empty pattern matches anything, otherwise one of values must match
+func matchAny(pattern string, values []string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	for _, v := range values {
+		if matched, _ := path.Match(pattern, strings.TrimSpace(v)); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AnyUser - any user from a htpasswd file
+	AnyUser = "*"
+)
+
+type (
+	HtpasswdConfig struct {
+		// File - apache htpasswd file, bcrypt and {SHA} hashes are supported
+		File string `yaml:"file"`
+		// ReadUsers, WriteUsers - users allowed to read and to put or delete files, "*" means any user.
+		// Writers can read too
+		ReadUsers  []string `yaml:"read_users"`
+		WriteUsers []string `yaml:"write_users"`
+	}
+
+	// Htpasswd - basic auth of a single repository by htpasswd file, the file is reloaded on change
+	Htpasswd struct {
+		path       string
+		repository string
+		readUsers  []string
+		writeUsers []string
+		logger     *slog.Logger
+		mut        sync.RWMutex
+		users      map[string]string
+		// verified - sha256 of checked passwords, bcrypt is too slow to check it on every request
+		verified map[string][sha256.Size]byte
+	}
+)
+
+func NewHtpasswd(ctx context.Context, cfg *HtpasswdConfig, repository string, logger *slog.Logger) (*Htpasswd, error) {
+	if cfg.File == "" {
+		return nil, fmt.Errorf("repository %s: htpasswd file is required", repository)
+	}
+
+	h := &Htpasswd{
+		path:       cfg.File,
+		repository: repository,
+		readUsers:  cfg.ReadUsers,
+		writeUsers: cfg.WriteUsers,
+		logger: logger.With(
+			slog.String("prefix", repository),
+			slog.String("htpasswd", cfg.File),
+		),
+	}
+
+	if err := h.Load(); err != nil {
+		return nil, fmt.Errorf("repository %s: %w", repository, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("repository %s: htpasswd watcher err: %w", repository, err)
+	}
+
+	// a dir is watched, because editors and htpasswd tool replace a file by rename
+	if err = watcher.Add(filepath.Dir(h.path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("repository %s: htpasswd watcher err: %w", repository, err)
+	}
+
+	go h.ReloadOnChange(ctx, watcher)
+
+	return h, nil
+}
+
+// Load - reads users from a file, lines with unsupported hashes are skipped
+func (h *Htpasswd) Load() error {
+	content, err := os.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("htpasswd read err: %w", err)
+	}
+
+	users := make(map[string]string, 10)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(text, ":")
+		if !found || user == "" {
+			h.logger.Warn("bad htpasswd line, skipped", slog.Int("line", line))
+			continue
+		}
+
+		if !isSupportedHash(hash) {
+			h.logger.Warn("unsupported htpasswd hash, only bcrypt and {SHA} are supported",
+				slog.Int("line", line),
+				slog.String("user", user),
+			)
+			continue
+		}
+
+		users[user] = hash
+	}
+
+	h.mut.Lock()
+	h.users = users
+	h.verified = make(map[string][sha256.Size]byte, len(users))
+	h.mut.Unlock()
+
+	h.logger.Info("htpasswd loaded", slog.Int("users", len(users)))
+	return nil
+}
+
+func (h *Htpasswd) ReloadOnChange(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if filepath.Clean(event.Name) != filepath.Clean(h.path) || event.Has(fsnotify.Chmod) {
+				continue
+			}
+
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// a new file is expected by a next create event, current users are kept
+				continue
+			}
+
+			if err := h.Load(); err != nil {
+				h.logger.Error("htpasswd reload err, previous users are used", slog.String("err", err.Error()))
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			h.logger.Error("htpasswd watcher err", slog.String("err", err.Error()))
+		case <-ctx.Done():
+			h.logger.Info("htpasswd watcher stopped")
+			return
+		}
+	}
+}
+
+// Authenticate - checks basic auth credentials, permissions are granted only on a configured repository
+func (h *Htpasswd) Authenticate(req *http.Request) (*Principal, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	if !h.verify(user, password) {
+		return nil, fmt.Errorf("user %s: %w", user, ErrInvalidCredentials)
+	}
+
+	perm := Permission{Repository: h.repository}
+	if slices.Contains(h.writeUsers, user) || slices.Contains(h.writeUsers, AnyUser) {
+		perm.Operations = []Operation{OpRead, OpPut, OpDelete}
+	} else if slices.Contains(h.readUsers, user) || slices.Contains(h.readUsers, AnyUser) {
+		perm.Operations = []Operation{OpRead}
+	}
+
+	return &Principal{Name: "user:" + user, Permissions: []Permission{perm}}, nil
+}
+
+func (h *Htpasswd) verify(user, password string) bool {
+	sum := sha256.Sum256([]byte(password))
+
+	h.mut.RLock()
+	hash, found := h.users[user]
+	verified, cached := h.verified[user]
+	h.mut.RUnlock()
+
+	if !found {
+		return false
+	}
+
+	if cached {
+		return subtle.ConstantTimeCompare(verified[:], sum[:]) == 1
+	}
+
+	if err := checkHash(hash, password); err != nil {
+		return false
+	}
+
+	h.mut.Lock()
+	// a file may be reloaded during a check
+	if h.users[user] == hash {
+		h.verified[user] = sum
+	}
+	h.mut.Unlock()
+
+	return true
+}
+
+func isSupportedHash(hash string) bool {
+	return strings.HasPrefix(hash, "{SHA}") || strings.HasPrefix(hash, "$2")
+}
+
+func checkHash(hash, password string) error {
+	if encoded, found := strings.CutPrefix(hash, "{SHA}"); found {
+		sum := sha1.Sum([]byte(password))
+		if subtle.ConstantTimeCompare([]byte(encoded), []byte(base64.StdEncoding.EncodeToString(sum[:]))) != 1 {
+			return errors.New("password mismatch")
+		}
+
+		return nil
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
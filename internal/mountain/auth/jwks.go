@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"lua-mountain/pkg/slogan"
+)
+
+const (
+	defaultJWKSRefreshInterval = time.Hour
+	// jwksMinRefreshInterval - unknown key ids force a refresh, but not more often than that
+	jwksMinRefreshInterval = time.Minute
+	jwksRequestTimeout     = time.Second * 10
+	maxJWKSSize            = 1 << 20
+)
+
+type (
+	// jwk - json web key (rfc 7517), only public RSA and EC keys are supported
+	jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	jwksDocument struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	// JWKS - public keys of a token issuer from a local file or an url, keys are refreshed periodically
+	JWKS struct {
+		file    string
+		url     string
+		refresh time.Duration
+		client  *http.Client
+		logger  *slog.Logger
+		mut     sync.RWMutex
+		keys    map[string]crypto.PublicKey
+		fetched time.Time
+	}
+)
+
+func NewJWKS(ctx context.Context, file, url string, refresh time.Duration, logger *slog.Logger) (*JWKS, error) {
+	if (file == "") == (url == "") {
+		return nil, errors.New("jwks: one of jwks_file or jwks_url is required")
+	}
+
+	ks := &JWKS{
+		file:    file,
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksRequestTimeout},
+		logger:  logger,
+	}
+
+	if ks.refresh == 0 {
+		ks.refresh = defaultJWKSRefreshInterval
+	}
+
+	if err := ks.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	go ks.RefreshOnInterval(ctx)
+
+	return ks, nil
+}
+
+// Key - returns a key by id, an empty id is allowed when a set has a single key
+func (ks *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	// an issuer may rotate keys earlier than a next refresh
+	ks.mut.RLock()
+	canRefresh := time.Since(ks.fetched) > jwksMinRefreshInterval
+	ks.mut.RUnlock()
+
+	if canRefresh {
+		if err := ks.Load(ctx); err != nil {
+			ks.logger.WarnContext(ctx, "jwks reload err", slog.String("err", err.Error()))
+		} else if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("jwks: key %q not found", kid)
+}
+
+func (ks *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mut.RLock()
+	defer ks.mut.RUnlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Load - reads and parses a key set, on errors previous keys are kept
+func (ks *JWKS) Load(ctx context.Context) error {
+	content, err := ks.read(ctx)
+
+	ks.mut.Lock()
+	ks.fetched = time.Now()
+	ks.mut.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return err
+	}
+
+	ks.mut.Lock()
+	ks.keys = keys
+	ks.mut.Unlock()
+
+	ks.logger.InfoContext(ctx, "jwks loaded", slog.Int("keys", len(keys)))
+	return nil
+}
+
+func (ks *JWKS) RefreshOnInterval(ctx context.Context) {
+	ticker := time.NewTicker(ks.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ks.Load(ctx); err != nil {
+				ks.logger.ErrorContext(ctx, "jwks refresh err, previous keys are used", slog.String("err", err.Error()))
+			}
+		case <-ctx.Done():
+			ks.logger.Info("jwks refresh stopped")
+			return
+		}
+	}
+}
+
+func (ks *JWKS) read(ctx context.Context) ([]byte, error) {
+	if ks.file != "" {
+		content, err := os.ReadFile(ks.file)
+		if err != nil {
+			return nil, fmt.Errorf("jwks read err: %w", err)
+		}
+
+		return content, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("jwks build request err: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks http req err: %w", err)
+	}
+
+	defer resp.Body.Close()
+	ks.logger.DebugContext(ctx, "http request end",
+		slogan.SanitizedURL("addr", req.URL),
+		slog.String("status", resp.Status),
+		slog.Duration("dur", time.Since(start)),
+	)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: GET %s END=%d", req.URL.Redacted(), resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS - parses a key set, keys of unsupported types and keys for encryption are skipped
+func parseJWKS(content []byte) (map[string]crypto.PublicKey, error) {
+	var doc jwksDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("jwks decode err: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+		}
+
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no signing keys found")
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad n: %w", err)
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad e: %w", err)
+		}
+
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("bad e")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x: %w", err)
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bad y: %w", err)
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
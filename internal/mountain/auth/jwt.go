@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	defaultJWTLeeway = time.Second * 30
+)
+
+var (
+	// jwtMethods - asymmetric algorithms only, keys come from a public key set
+	jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+)
+
+type (
+	JWTConfig struct {
+		Issuer   string `yaml:"issuer"`
+		Audience string `yaml:"audience"`
+		// JWKSFile, JWKSUrl - public keys of an issuer, like https://gitlab.example.com/oauth/discovery/keys
+		JWKSFile    string        `yaml:"jwks_file"`
+		JWKSUrl     string        `yaml:"jwks_url"`
+		JWKSRefresh time.Duration `yaml:"jwks_refresh"`
+		// Leeway - allowed clock skew for exp, nbf and iat claims
+		Leeway time.Duration `yaml:"leeway"`
+		// Rules - tokens get permissions of all matched rules, tokens without matches are rejected
+		Rules []JWTRule `yaml:"rules"`
+	}
+
+	// JWTRule - claims patterns (path.Match syntax) and permissions, which are granted on a match of all claims
+	JWTRule struct {
+		Claims      map[string]string `yaml:"claims"`
+		Permissions []Permission      `yaml:"permissions"`
+	}
+
+	// JWT - authenticator of bearer jwt, issued by an oidc provider of ci system
+	JWT struct {
+		cfg    JWTConfig
+		keys   *JWKS
+		parser *jwt.Parser
+		logger *slog.Logger
+	}
+)
+
+func NewJWT(ctx context.Context, cfg *JWTConfig, logger *slog.Logger) (*JWT, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("jwt: issuer and audience are required")
+	}
+
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("jwt: rules are required")
+	}
+
+	for i, rule := range cfg.Rules {
+		for claim, pattern := range rule.Claims {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("jwt: rule %d: claim %s: bad pattern %q", i, claim, pattern)
+			}
+		}
+	}
+
+	logger = logger.With(slog.String("component", "jwt"), slog.String("issuer", cfg.Issuer))
+	keys, err := NewJWKS(ctx, cfg.JWKSFile, cfg.JWKSUrl, cfg.JWKSRefresh, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &JWT{
+		cfg:  *cfg,
+		keys: keys,
+		// time claims are checked with leeway by Authenticate
+		// numbers are kept as json.Number, so ids like project_id: 12345678 are matched by their text
+		parser: &jwt.Parser{ValidMethods: jwtMethods, SkipClaimsValidation: true, UseJSONNumber: true},
+		logger: logger,
+	}
+
+	if a.cfg.Leeway == 0 {
+		a.cfg.Leeway = defaultJWTLeeway
+	}
+
+	return a, nil
+}
+
+// Authenticate - accepts a jwt as a bearer token or as a basic auth password
+func (a *JWT) Authenticate(req *http.Request) (*Principal, error) {
+	raw, ok := credential(req)
+	if !ok || !looksLikeJWT(raw) {
+		return nil, ErrNoCredentials
+	}
+
+	ctx := req.Context()
+	token, err := a.parser.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.Key(ctx, kid)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %s: %w", err.Error(), ErrInvalidCredentials)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("jwt: bad claims: %w", ErrInvalidCredentials)
+	}
+
+	if err = a.validate(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("jwt: %s: %w", err.Error(), ErrInvalidCredentials)
+	}
+
+	subject, _ := claims["sub"].(string)
+	p := &Principal{Name: "jwt:" + subject}
+	for _, rule := range a.cfg.Rules {
+		if rule.Match(claims) {
+			p.Permissions = append(p.Permissions, rule.Permissions...)
+		}
+	}
+
+	if len(p.Permissions) == 0 {
+		a.logger.InfoContext(ctx, "jwt does not match any rule", slog.String("sub", subject))
+		return nil, fmt.Errorf("jwt: no rules matched: %w", ErrInvalidCredentials)
+	}
+
+	return p, nil
+}
+
+func (a *JWT) validate(claims jwt.MapClaims, now time.Time) error {
+	if !claims.VerifyIssuer(a.cfg.Issuer, true) {
+		return errors.New("bad issuer")
+	}
+
+	if !claims.VerifyAudience(a.cfg.Audience, true) {
+		return errors.New("bad audience")
+	}
+
+	leeway := int64(a.cfg.Leeway.Seconds())
+	if !claims.VerifyExpiresAt(now.Unix()-leeway, true) {
+		return errors.New("token is expired")
+	}
+
+	if !claims.VerifyNotBefore(now.Unix()+leeway, false) {
+		return errors.New("token is not valid yet")
+	}
+
+	if !claims.VerifyIssuedAt(now.Unix()+leeway, false) {
+		return errors.New("token is issued in future")
+	}
+
+	return nil
+}
+
+// Match - all rule claims must exist and match their patterns
+func (rule *JWTRule) Match(claims jwt.MapClaims) bool {
+	for claim, pattern := range rule.Claims {
+		value, ok := claims[claim]
+		if !ok {
+			return false
+		}
+
+		if matched, _ := path.Match(pattern, claimString(value)); !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// claimString - a claim value as it's written in a token: 12345678, not 1.2345678e+07
+func claimString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// looksLikeJWT - compact jws: three base64 parts, a header is a json object
+func looksLikeJWT(s string) bool {
+	return strings.HasPrefix(s, "eyJ") && strings.Count(s, ".") == 2
+}
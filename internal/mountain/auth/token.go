@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"lua-mountain/internal/mountain/storage"
+)
+
+const (
+	// TokenPrefix - tokens look like mnt_<id>_<secret>, so they are recognized among other credentials
+	TokenPrefix = "mnt_"
+
+	defaultTokensRefreshInterval = time.Second * 10
+	defaultTokensKey             = ".mountain-tokens.json"
+	tokensReloadTimeout          = time.Second * 10
+	tokenIDSize                  = 8
+	tokenSecretSize              = 32
+)
+
+type (
+	TokensConfig struct {
+		// File - local json file with tokens
+		File string `yaml:"file"`
+		// Storage, Key - tokens are kept in a storage object, when a file is not set
+		Storage string `yaml:"storage"`
+		Key     string `yaml:"key"`
+		// RefreshInterval - how often tokens are reloaded, so changes by cli are applied without restart
+		RefreshInterval time.Duration `yaml:"refresh_interval"`
+	}
+
+	// Token - api token, only a sha256 hash of its secret is stored
+	Token struct {
+		ID          string       `json:"id"`
+		Name        string       `json:"name"`
+		Hash        string       `json:"hash"`
+		Permissions []Permission `json:"permissions"`
+		CreatedAt   time.Time    `json:"created_at"`
+		ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+	}
+
+	tokensFile struct {
+		Tokens []*Token `json:"tokens"`
+	}
+
+	// TokenStore - tokens authenticator and manager
+	TokenStore struct {
+		backend tokenBackend
+		refresh time.Duration
+		logger  *slog.Logger
+		mut     sync.RWMutex
+		tokens  map[string]*Token
+		loaded  time.Time
+		// saves - a number of saves, a reload, which has read tokens before a save, does not mark them fresh
+		saves uint64
+		// reload - a single reload at a time, requests, which find tokens stale, wait for it
+		reload singleflight.Group
+	}
+
+	tokenBackend interface {
+		read(ctx context.Context) ([]byte, error)
+		write(ctx context.Context, content []byte) error
+	}
+
+	fileTokenBackend struct {
+		path string
+	}
+
+	storageTokenBackend struct {
+		storage storage.Storage
+		key     string
+	}
+)
+
+func NewTokenStore(cfg *TokensConfig, storages storage.Storages, logger *slog.Logger) (*TokenStore, error) {
+	ts := &TokenStore{
+		refresh: cfg.RefreshInterval,
+		logger:  logger.With(slog.String("component", "tokens")),
+		tokens:  make(map[string]*Token, 10),
+	}
+
+	switch {
+	case cfg.File != "":
+		ts.backend = &fileTokenBackend{path: cfg.File}
+	case cfg.Storage != "":
+		st, ok := storages[cfg.Storage]
+		if !ok {
+			return nil, fmt.Errorf("tokens: storage %s not found", cfg.Storage)
+		}
+
+		key := cfg.Key
+		if key == "" {
+			key = defaultTokensKey
+		}
+
+		ts.backend = &storageTokenBackend{storage: st, key: key}
+	default:
+		return nil, errors.New("tokens: file or storage is required")
+	}
+
+	if ts.refresh == 0 {
+		ts.refresh = defaultTokensRefreshInterval
+	}
+
+	return ts, nil
+}
+
+// Authenticate - accepts a token as a bearer token or as a basic auth password, any username is allowed.
+// Basic auth is needed by luarocks, which can pass only user:password@ in a server url
+func (ts *TokenStore) Authenticate(req *http.Request) (*Principal, error) {
+	raw, ok := credential(req)
+	if !ok || !strings.HasPrefix(raw, TokenPrefix) {
+		return nil, ErrNoCredentials
+	}
+
+	id, secret, ok := parseToken(raw)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	ts.reloadIfStale(req.Context())
+
+	ts.mut.RLock()
+	token := ts.tokens[id]
+	ts.mut.RUnlock()
+
+	if token == nil || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	if token.Expired(time.Now()) {
+		return nil, fmt.Errorf("token %s is expired: %w", token.ID, ErrInvalidCredentials)
+	}
+
+	return &Principal{Name: "token:" + token.Name, Permissions: token.Permissions}, nil
+}
+
+// Create - generates a token, a returned raw token can not be restored later
+func (ts *TokenStore) Create(ctx context.Context, name string, perms []Permission, ttl time.Duration) (string, *Token, error) {
+	tokens, err := ts.load(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	id, err := randomHex(tokenIDSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomHex(tokenSecretSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &Token{
+		ID:          id,
+		Name:        name,
+		Hash:        hashSecret(secret),
+		Permissions: perms,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	if ttl > 0 {
+		expires := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	if err = ts.save(ctx, append(tokens, token)); err != nil {
+		return "", nil, err
+	}
+
+	return TokenPrefix + id + "_" + secret, token, nil
+}
+
+// List - returns all tokens, including expired
+func (ts *TokenStore) List(ctx context.Context) ([]*Token, error) {
+	return ts.load(ctx)
+}
+
+// Revoke - removes a token by id
+func (ts *TokenStore) Revoke(ctx context.Context, id string) error {
+	tokens, err := ts.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	n := len(tokens)
+	tokens = slices.DeleteFunc(tokens, func(t *Token) bool {
+		return t.ID == id
+	})
+
+	if len(tokens) == n {
+		return fmt.Errorf("token %s: %w", id, os.ErrNotExist)
+	}
+
+	return ts.save(ctx, tokens)
+}
+
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// reloadIfStale - rereads tokens once per refresh interval, on errors previous tokens are kept.
+// Tokens are read without a lock, so authentication by previous tokens is not blocked by a slow backend
+func (ts *TokenStore) reloadIfStale(ctx context.Context) {
+	ts.mut.RLock()
+	stale := time.Since(ts.loaded) > ts.refresh
+	ts.mut.RUnlock()
+
+	if !stale {
+		return
+	}
+
+	// a reload is not bound to a request, which started it, a request stops waiting by its ctx
+	ch := ts.reload.DoChan("tokens", func() (any, error) {
+		ts.mut.RLock()
+		stale, saves := time.Since(ts.loaded) > ts.refresh, ts.saves
+		ts.mut.RUnlock()
+
+		if !stale {
+			return nil, nil
+		}
+
+		rCtx, done := context.WithTimeout(context.WithoutCancel(ctx), tokensReloadTimeout)
+		defer done()
+
+		tokens, err := ts.load(rCtx)
+		ts.mut.Lock()
+		defer ts.mut.Unlock()
+
+		if ts.saves != saves {
+			// tokens are saved during a read, a next request rereads them
+			return nil, nil
+		}
+
+		// failed reloads are retried after an interval too
+		ts.loaded = time.Now()
+		if err != nil {
+			ts.logger.WarnContext(ctx, "unable to reload tokens, previous are used", slog.String("err", err.Error()))
+			return nil, nil
+		}
+
+		next := make(map[string]*Token, len(tokens))
+		for _, token := range tokens {
+			next[token.ID] = token
+		}
+
+		ts.tokens = next
+		return nil, nil
+	})
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+}
+
+func (ts *TokenStore) load(ctx context.Context) ([]*Token, error) {
+	content, err := ts.backend.read(ctx)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("tokens read err: %w", err)
+	}
+
+	var f tokensFile
+	if err = json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("tokens decode err: %w", err)
+	}
+
+	return f.Tokens, nil
+}
+
+func (ts *TokenStore) save(ctx context.Context, tokens []*Token) error {
+	if tokens == nil {
+		tokens = []*Token{}
+	}
+
+	content, err := json.MarshalIndent(tokensFile{Tokens: tokens}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("tokens encode err: %w", err)
+	}
+
+	if err = ts.backend.write(ctx, content); err != nil {
+		return fmt.Errorf("tokens write err: %w", err)
+	}
+
+	// next request rereads tokens
+	ts.mut.Lock()
+	ts.loaded = time.Time{}
+	ts.saves++
+	ts.mut.Unlock()
+
+	return nil
+}
+
+func (fb *fileTokenBackend) read(_ context.Context) ([]byte, error) {
+	return os.ReadFile(fb.path)
+}
+
+// write - replaces a file atomically, so a running server never reads a partial file
+func (fb *fileTokenBackend) write(_ context.Context, content []byte) error {
+	tmp := fb.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, fb.path)
+}
+
+func (sb *storageTokenBackend) read(ctx context.Context) ([]byte, error) {
+	f, err := sb.storage.Get(ctx, sb.key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (sb *storageTokenBackend) write(ctx context.Context, content []byte) error {
+	return sb.storage.Put(ctx, sb.key, bytes.NewReader(content))
+}
+
+// credential - returns a bearer token or a basic auth password
+func credential(req *http.Request) (string, bool) {
+	if _, password, ok := req.BasicAuth(); ok {
+		return password, true
+	}
+
+	scheme, value, found := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	return strings.TrimSpace(value), true
+}
+
+func parseToken(raw string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(strings.TrimPrefix(raw, TokenPrefix), "_")
+	return id, secret, ok && len(id) == tokenIDSize*2 && len(secret) == tokenSecretSize*2
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random read err: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+
+// slowTokenBackend - a backend, reads of which wait for a release
+type slowTokenBackend struct {
+	content []byte
+	reads   atomic.Int32
+	release chan struct{}
+}
+
+func (b *slowTokenBackend) read(context.Context) ([]byte, error) {
+	b.reads.Add(1)
+	<-b.release
+	return b.content, nil
+}
+
+func (b *slowTokenBackend) write(context.Context, []byte) error {
+	return nil
+}
+
+// TestTokenStoreReload - a single reload runs for concurrent requests and it does not hold a lock of tokens
+func TestTokenStoreReload(t *testing.T) {
+	const requests = 10
+
+	backend := &slowTokenBackend{
+		content: []byte(`{"tokens": [{"id": "0011223344556677", "name": "ci", "hash": "` + hashSecret(testSecret) + `"}]}`),
+		release: make(chan struct{}),
+	}
+	ts := &TokenStore{
+		backend: backend,
+		refresh: time.Hour,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		tokens:  make(map[string]*Token),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+TokenPrefix+"0011223344556677_"+testSecret)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ts.Authenticate(req)
+			errs <- err
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	// tokens are readable during a reload
+	locked := make(chan struct{})
+	go func() {
+		ts.mut.RLock()
+		ts.mut.RUnlock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("tokens are locked during a read of a backend")
+	}
+
+	close(backend.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	if reads := backend.reads.Load(); reads != 1 {
+		t.Errorf("got %d reads, want 1", reads)
+	}
+}
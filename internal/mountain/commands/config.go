@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"lua-mountain/internal/mountain/config"
+)
+
+func ConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "config",
+		Usage:       "mountain config dump|validate",
+		Description: "inspects a config file",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "dump",
+				Usage: "mountain config dump",
+				Description: "prints a config with expanded ${VAR}, file: values and MOUNTAIN_* overrides, " +
+					"secrets are redacted",
+				Action: dumpConfig,
+			},
+			{
+				Name:        "validate",
+				Usage:       "mountain config validate",
+				Description: "checks unknown keys, storages and repositories, prints all problems with lines",
+				Action:      validateConfig,
+			},
+		},
+	}
+}
+
+func dumpConfig(c *cli.Context) error {
+	content, err := config.Dump(config.Path())
+	if err != nil {
+		return err
+	}
+
+	_, err = c.App.Writer.Write(content)
+	return err
+}
+
+func validateConfig(c *cli.Context) error {
+	err := checkConfig(config.Path(), func(problem config.Problem) {
+		fmt.Fprintln(c.App.Writer, problem.String())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.App.Writer, "%s is valid\n", config.Path())
+	return err
+}
+
+// checkConfig - reports config problems one by one, an error is returned, when any problem is found
+func checkConfig(p string, report func(config.Problem)) error {
+	problems, err := config.Validate(p)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		report(problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d config problems found", len(problems))
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"lua-mountain/internal/mountain/config"
+	"lua-mountain/internal/mountain/logging"
+	"lua-mountain/internal/mountain/server"
+	"lua-mountain/internal/mountain/storage"
+)
+
+const (
+	// reloadDelay - editors write a file by several events, a reload waits for the last one
+	reloadDelay = time.Millisecond * 500
+)
+
+type (
+	// pooledStorage - a storage with own background context, which is stopped on removal or change of its config
+	pooledStorage struct {
+		cfg     any
+		storage storage.Storage
+		cancel  context.CancelFunc
+	}
+
+	// storagePool - initialized storages by name
+	storagePool map[string]*pooledStorage
+
+	// reloader - replaces routes by routes of a changed config, storages with unchanged config are reused
+	reloader struct {
+		path       string
+		strict     bool
+		logger     *slog.Logger
+		mut        sync.Mutex
+		cfg        *config.AppConfig
+		pool       storagePool
+		handler    *server.Handler
+		stopRoutes context.CancelFunc
+	}
+)
+
+func newStoragePool(ctx context.Context, cfgs map[string]any, logger *slog.Logger) storagePool {
+	return storagePool(nil).Update(ctx, cfgs, logger)
+}
+
+// Update - returns a pool of configured storages, storages with unchanged config are taken from p,
+// others are initialized. Storages of p are not stopped, see Release
+func (p storagePool) Update(ctx context.Context, cfgs map[string]any, logger *slog.Logger) storagePool {
+	next := make(storagePool, len(cfgs))
+	for name, storageCfg := range cfgs {
+		if prev, ok := p[name]; ok && reflect.DeepEqual(prev.cfg, storageCfg) {
+			next[name] = prev
+			continue
+		}
+
+		sCtx, cancel := context.WithCancel(ctx)
+		st, ok := storage.InitStorages(sCtx, map[string]any{name: storageCfg}, logger)[name]
+		if !ok {
+			cancel()
+			continue
+		}
+
+		next[name] = &pooledStorage{cfg: storageCfg, storage: st, cancel: cancel}
+	}
+
+	return next
+}
+
+// Release - stops background goroutines of storages, which are not used by next pool
+func (p storagePool) Release(next storagePool) {
+	for name, ps := range p {
+		if next[name] != ps {
+			ps.cancel()
+		}
+	}
+}
+
+func (p storagePool) Storages() storage.Storages {
+	storages := make(storage.Storages, len(p))
+	for name, ps := range p {
+		storages[name] = ps.storage
+	}
+
+	return storages
+}
+
+// Watch - reloads a config on SIGHUP and on change of a config file, until ctx is done.
+// An error means, that only SIGHUP reloads a config
+func (r *reloader) Watch(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		go r.ReloadOnChange(ctx, hup, nil)
+		return fmt.Errorf("config watcher err: %w", err)
+	}
+
+	// a dir is watched, because editors and config management tools replace a file by rename
+	if err = watcher.Add(filepath.Dir(r.path)); err != nil {
+		watcher.Close()
+		go r.ReloadOnChange(ctx, hup, nil)
+		return fmt.Errorf("config watcher err: %w", err)
+	}
+
+	go r.ReloadOnChange(ctx, hup, watcher)
+	return nil
+}
+
+func (r *reloader) ReloadOnChange(ctx context.Context, hup chan os.Signal, watcher *fsnotify.Watcher) {
+	defer signal.Stop(hup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+		delay  = time.NewTimer(reloadDelay)
+	)
+
+	delay.Stop()
+	defer delay.Stop()
+
+	if watcher != nil {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	for {
+		select {
+		case <-hup:
+			r.logger.Info("SIGHUP received, reloading config", slog.String("path", r.path))
+			r.reload(ctx)
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+
+			if filepath.Clean(event.Name) != filepath.Clean(r.path) || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+
+			delay.Reset(reloadDelay)
+		case <-delay.C:
+			r.logger.Info("config file changed, reloading config", slog.String("path", r.path))
+			r.reload(ctx)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			r.logger.Error("config watcher err", slog.String("err", err.Error()))
+		case <-ctx.Done():
+			r.logger.Info("config watcher stopped")
+			return
+		}
+	}
+}
+
+func (r *reloader) reload(ctx context.Context) {
+	if err := r.Reload(ctx); err != nil {
+		r.logger.Error("config reload err, previous config is used", slog.String("err", err.Error()))
+	}
+}
+
+// Reload - reads a config and replaces routes. Requests, which are accepted by previous routes,
+// are finished by them. On errors previous routes and storages are kept
+func (r *reloader) Reload(ctx context.Context) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.strict {
+		if err := checkConfig(r.path, logProblem(r.logger)); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.Read(r.path)
+	if err != nil {
+		return fmt.Errorf("config read err: %w", err)
+	}
+
+	if !reflect.DeepEqual(cfg.Listen, r.cfg.Listen) {
+		r.logger.Warn("listen section is changed, changes are applied on restart")
+	}
+
+	if !reflect.DeepEqual(cfg.Logs, r.cfg.Logs) {
+		r.logger.Warn("logs section is changed, changes are applied on restart")
+	}
+
+	pool := r.pool.Update(ctx, cfg.Storages, logging.DefaultLogger)
+	routesCtx, stopRoutes := context.WithCancel(ctx)
+	srv, err := newServer(routesCtx, cfg, pool.Storages())
+	if err != nil {
+		stopRoutes()
+		pool.Release(r.pool)
+		return err
+	}
+
+	r.handler.Swap(srv)
+	r.stopRoutes()
+	r.pool.Release(pool)
+	r.cfg, r.pool, r.stopRoutes = cfg, pool, stopRoutes
+
+	r.logger.Info("config reloaded",
+		slog.Int("storages", len(pool)),
+		slog.Int("repositories", len(cfg.Repositories)),
+	)
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"lua-mountain/internal/mountain/config"
+	"lua-mountain/internal/mountain/server"
+	pstorage "lua-mountain/pkg/storage"
+)
+
+const notifierType = "test-notifier"
+
+type (
+	notifierConfig struct {
+		Name string `yaml:"name"`
+	}
+
+	// notifierStorage - an empty storage, which counts live change callbacks
+	notifierStorage struct {
+		mut       sync.Mutex
+		callbacks int
+	}
+)
+
+var notifierStorages sync.Map
+
+func init() {
+	pstorage.Register(notifierType, pstorage.NewDriver(
+		func() *notifierConfig { return &notifierConfig{} },
+		func(_ context.Context, name string, _ *notifierConfig, _ *slog.Logger) (pstorage.Storage, error) {
+			st := &notifierStorage{}
+			notifierStorages.Store(name, st)
+			return st, nil
+		},
+	))
+}
+
+func (cfg *notifierConfig) Validate() error {
+	return nil
+}
+
+func (s *notifierStorage) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, os.ErrNotExist
+}
+
+func (s *notifierStorage) Exists(context.Context, string) error {
+	return os.ErrNotExist
+}
+
+func (s *notifierStorage) Put(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (s *notifierStorage) Delete(context.Context, string) error {
+	return nil
+}
+
+func (s *notifierStorage) List(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (s *notifierStorage) OnChange(ctx context.Context, _ func(filename string)) {
+	s.mut.Lock()
+	s.callbacks++
+	s.mut.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		s.mut.Lock()
+		s.callbacks--
+		s.mut.Unlock()
+	})
+}
+
+// Callbacks - a number of live callbacks, callbacks of done contexts are removed asynchronously, so it's awaited
+func (s *notifierStorage) Callbacks(want int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mut.Lock()
+		got := s.callbacks
+		s.mut.Unlock()
+
+		if got == want || time.Now().After(deadline) {
+			return got
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// TestReloadKeepsCallbacks - a reused storage must not keep callbacks of repositories of previous configs
+func TestReloadKeepsCallbacks(t *testing.T) {
+	const reloads = 5
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+repositories:
+  - {prefix: internal, storage: reused}
+  - {prefix: vendored, storage: reused}
+  - {prefix: all, members: [internal, vendored]}
+storages:
+  reused: {type: ` + notifierType + `, name: reused}
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Read(path)
+	if err != nil {
+		t.Fatalf("config read err: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pool := newStoragePool(ctx, cfg.Storages, logger)
+	routesCtx, stopRoutes := context.WithCancel(ctx)
+	srv, err := newServer(routesCtx, cfg, pool.Storages())
+	if err != nil {
+		t.Fatalf("server err: %v", err)
+	}
+
+	r := &reloader{
+		path:       path,
+		cfg:        cfg,
+		pool:       pool,
+		handler:    &server.Handler{},
+		stopRoutes: stopRoutes,
+		logger:     logger,
+	}
+	r.handler.Swap(srv)
+
+	v, _ := notifierStorages.Load("reused")
+	st := v.(*notifierStorage)
+	if got := st.Callbacks(2); got != 2 {
+		t.Fatalf("got %d callbacks before reloads, want 2", got)
+	}
+
+	for i := 0; i < reloads; i++ {
+		if err = r.Reload(ctx); err != nil {
+			t.Fatalf("reload %d err: %v", i, err)
+		}
+
+		if v, _ = notifierStorages.Load("reused"); v.(*notifierStorage) != st {
+			t.Fatalf("reload %d: storage with unchanged config is not reused", i)
+		}
+
+		if got := st.Callbacks(2); got != 2 {
+			t.Errorf("reload %d: got %d callbacks, want 2", i, got)
+		}
+	}
+}
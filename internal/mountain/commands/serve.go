@@ -4,15 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
 
 	"lua-mountain/internal/mountain/config"
 	"lua-mountain/internal/mountain/logging"
-	"lua-mountain/internal/mountain/repository"
 	"lua-mountain/internal/mountain/server"
-	"lua-mountain/internal/mountain/server/mw"
 	"lua-mountain/internal/mountain/storage"
+	"lua-mountain/pkg/mountain"
 )
 
 func StartCommand() *cli.Command {
@@ -31,6 +34,10 @@ func StartCommand() *cli.Command {
 				Category: "http",
 				Usage:    "--port 2023",
 			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "--strict, refuses to start or to reload with config problems (see mountain config validate)",
+			},
 		},
 		Category: "",
 		Action:   startRocksServer,
@@ -39,43 +46,31 @@ func StartCommand() *cli.Command {
 
 func startRocksServer(c *cli.Context) error {
 	cfg := config.Get()
-	srv := server.Init()
-	storages := storage.InitStorages(context.Background(), cfg.Storages, logging.DefaultLogger)
-	for _, repoCfg := range cfg.Repositories {
-		st, ok := storages[repoCfg.Storage]
-		if !ok {
-			slog.Warn("unable to find repository storage",
-				slog.String("repository", repoCfg.Prefix),
-				slog.String("storage", repoCfg.Storage),
-			)
-			continue
-		}
-
-		repo := repository.New(&repoCfg, st, logging.DefaultLogger)
-		extMw := mw.AllowedExtensions(repo.AllowedFileExtensions)
-		rGroup := srv.Group(repoCfg.Prefix)
-		for _, man := range []string{"manifest", "manifest-5.1", "manifest-5.2", "manifest-5.3", "manifest-5.4"} {
-			rGroup.GET("/"+man, repo.GetManifest)
-			rGroup.GET("/"+man+".json", repo.GetManifestJson)
-			rGroup.GET("/"+man+".zip", repo.GetManifestZip)
+	if c.Bool("strict") {
+		if err := checkConfig(config.Path(), logProblem(logging.DefaultLogger)); err != nil {
+			return err
 		}
-
-		rGroup.GET("/:filename", repo.Get, extMw)
-		rGroup.PUT("/:filename", repo.Put, extMw)
-		rGroup.DELETE("/:filename", repo.Delete, extMw)
 	}
 
-	for _, r := range srv.Routes() {
-		if r.Method == "echo_route_not_found" {
-			continue
-		}
+	// storages, watchers and key refreshers run in background until the server is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		logging.DefaultLogger.Info("mountain`s route inited",
-			slog.String("method", r.Method),
-			slog.String("path", r.Path),
-		)
+	sigCtx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pool := newStoragePool(ctx, cfg.Storages, logging.DefaultLogger)
+	// auth watchers of routes are stopped on a replace of routes by a config reload
+	routesCtx, stopRoutes := context.WithCancel(ctx)
+	srv, err := newServer(routesCtx, cfg, pool.Storages())
+	if err != nil {
+		stopRoutes()
+		return err
 	}
 
+	handler := &server.Handler{}
+	handler.Swap(srv)
+
 	var (
 		address = c.String("address")
 		port    = c.String("port")
@@ -94,9 +89,47 @@ func startRocksServer(c *cli.Context) error {
 		slog.String("address", bindAddress),
 	)
 
-	if err := srv.Start(bindAddress); err != nil {
-		return err
+	httpSrv := &http.Server{Addr: bindAddress, Handler: handler}
+	if cfg.Listen.TLS != nil {
+		srvTLS, err := server.NewTLS(ctx, cfg.Listen.TLS, logging.DefaultLogger)
+		if err != nil {
+			stopRoutes()
+			return err
+		}
+
+		httpSrv.TLSConfig = srvTLS.Config()
+	} else if cfg.Auth.ClientCerts != nil {
+		logging.DefaultLogger.Warn("client certificates auth requires listen.tls section")
+	}
+
+	r := &reloader{
+		path:       config.Path(),
+		strict:     c.Bool("strict"),
+		cfg:        cfg,
+		pool:       pool,
+		handler:    handler,
+		stopRoutes: stopRoutes,
+		logger:     logging.DefaultLogger.With(slog.String("component", "reload")),
+	}
+
+	if err = r.Watch(ctx); err != nil {
+		logging.DefaultLogger.Warn("config reload on change is disabled", slog.String("err", err.Error()))
 	}
 
-	return nil
+	return server.Serve(sigCtx, httpSrv, cfg.Listen.ShutdownTimeout, logging.DefaultLogger)
+}
+
+// newServer - routes of a config file, background goroutines of routes are stopped by ctx
+func newServer(ctx context.Context, cfg *config.AppConfig, storages storage.Storages) (*mountain.Server, error) {
+	return mountain.New(ctx, &mountain.Config{
+		Repositories: cfg.Repositories,
+		Storages:     storages,
+		Auth:         cfg.Auth,
+	}, mountain.WithLogger(logging.DefaultLogger))
+}
+
+func logProblem(logger *slog.Logger) func(config.Problem) {
+	return func(problem config.Problem) {
+		logger.Error("config problem", slog.String("problem", problem.String()))
+	}
 }
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"lua-mountain/internal/mountain/config"
+	"lua-mountain/internal/mountain/logging"
+	"lua-mountain/internal/mountain/storage"
+	pstorage "lua-mountain/pkg/storage"
+)
+
+func StorageCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "storage",
+		Usage:       "mountain storage migrate",
+		Description: "maintains configured storages",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "migrate",
+				Usage:     "mountain storage migrate --layout hash <name>",
+				ArgsUsage: "<name>",
+				Description: "moves files of a fs storage to places of a layout, a layout of a config is used by default. " +
+					"Servers, which use a storage, must be stopped, then started with a new layout",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "layout",
+						Usage: "--layout flat|name|hash",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "--dry-run, files are only counted",
+					},
+				},
+				Action: migrateStorage,
+			},
+		},
+	}
+}
+
+func migrateStorage(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return errors.New("storage name is required")
+	}
+
+	section, ok := config.Get().Storages[name].(map[string]any)
+	if !ok {
+		return fmt.Errorf("storage %s is not configured", name)
+	}
+
+	if section[pstorage.TypeKey] != storage.FsType {
+		return fmt.Errorf("storage %s: only %s storages have layouts", name, storage.FsType)
+	}
+
+	driver, err := pstorage.DriverOf(section)
+	if err != nil {
+		return fmt.Errorf("storage %s: %w", name, err)
+	}
+
+	if layout := c.String("layout"); layout != "" {
+		section[storage.LayoutKey] = layout
+	}
+
+	cfg, err := pstorage.Decode(driver, section)
+	if err != nil {
+		return fmt.Errorf("storage %s: %w", name, err)
+	}
+
+	// files are moved by a walk of a dir, an index is not needed
+	fsCfg := cfg.(*storage.FsConfig)
+	fsCfg.Watch = false
+
+	st, err := storage.InitFsStorage(c.Context, name, fsCfg, logging.DefaultLogger)
+	if err != nil {
+		return err
+	}
+
+	result, err := st.Migrate(c.Context, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range result.Conflicts {
+		fmt.Fprintf(c.App.Writer, "%s is left, a file with the same name is already in place\n", conflict)
+	}
+
+	verb := "moved"
+	if c.Bool("dry-run") {
+		verb = "to move"
+	}
+
+	fmt.Fprintf(c.App.Writer, "storage %s, layout %s: %d files %s, %d conflicts\n",
+		name, st.Layout, result.Moved, verb, len(result.Conflicts))
+	if len(result.Conflicts) > 0 {
+		return fmt.Errorf("%d files are not moved", len(result.Conflicts))
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"lua-mountain/internal/mountain/auth"
+	"lua-mountain/internal/mountain/config"
+	"lua-mountain/internal/mountain/logging"
+	"lua-mountain/internal/mountain/storage"
+)
+
+func TokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "token",
+		Usage:       "mountain token create|list|revoke",
+		Description: "manages api tokens, tokens store is set by auth.tokens config section",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "mountain token create --name ci --permission rocks:read,put",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "--name ci",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:     "permission",
+						Aliases:  []string{"p"},
+						Usage:    "--permission rocks:read,put,delete (* means any repository or operation)",
+						Required: true,
+					},
+					&cli.DurationFlag{
+						Name:  "ttl",
+						Usage: "--ttl 720h, token never expires by default",
+					},
+				},
+				Action: createToken,
+			},
+			{
+				Name:   "list",
+				Usage:  "mountain token list",
+				Action: listTokens,
+			},
+			{
+				Name:      "revoke",
+				Usage:     "mountain token revoke <id>",
+				ArgsUsage: "<id>",
+				Action:    revokeToken,
+			},
+		},
+	}
+}
+
+func createToken(c *cli.Context) error {
+	store, err := tokenStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	perms := make([]auth.Permission, 0, len(c.StringSlice("permission")))
+	for _, p := range c.StringSlice("permission") {
+		perm, err := auth.ParsePermission(p)
+		if err != nil {
+			return err
+		}
+
+		perms = append(perms, perm)
+	}
+
+	raw, token, err := store.Create(c.Context, c.String("name"), perms, c.Duration("ttl"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "token %s created, it is shown only once:\n%s\n", token.ID, raw)
+	return nil
+}
+
+func listTokens(c *cli.Context) error {
+	store, err := tokenStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := store.List(c.Context)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPERMISSIONS\tCREATED\tEXPIRES")
+	now := time.Now()
+	for _, token := range tokens {
+		perms := make([]string, 0, len(token.Permissions))
+		for _, perm := range token.Permissions {
+			perms = append(perms, perm.String())
+		}
+
+		expires := "never"
+		if token.ExpiresAt != nil {
+			expires = token.ExpiresAt.Format(time.RFC3339)
+			if token.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			token.ID, token.Name, strings.Join(perms, " "), token.CreatedAt.Format(time.RFC3339), expires,
+		)
+	}
+
+	return w.Flush()
+}
+
+func revokeToken(c *cli.Context) error {
+	id := c.Args().First()
+	if id == "" {
+		return errors.New("token id is required")
+	}
+
+	store, err := tokenStore(c.Context)
+	if err != nil {
+		return err
+	}
+
+	if err = store.Revoke(c.Context, id); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "token %s revoked\n", id)
+	return nil
+}
+
+// tokenStore - opens a configured store, only a tokens storage is initialized
+func tokenStore(ctx context.Context) (*auth.TokenStore, error) {
+	cfg := config.Get()
+	if cfg.Auth.Tokens == nil {
+		return nil, errors.New("auth.tokens is not configured")
+	}
+
+	var storages storage.Storages
+	if name := cfg.Auth.Tokens.Storage; name != "" && cfg.Auth.Tokens.File == "" {
+		storages = storage.InitStorages(ctx, map[string]any{name: cfg.Storages[name]}, logging.DefaultLogger)
+	}
+
+	return auth.NewTokenStore(cfg.Auth.Tokens, storages, logging.DefaultLogger)
+}
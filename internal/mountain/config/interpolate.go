@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix - MOUNTAIN_LISTEN_PORT overrides listen.port, nested sections are joined by "_"
+	EnvPrefix = "MOUNTAIN_"
+	// FilePrefix - a value like file:/run/secrets/nexus is replaced by a content of a file
+	FilePrefix = "file:"
+	Redacted   = "******"
+)
+
+var (
+	// envRe - ${VAR} or ${VAR:-default}
+	envRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?}`)
+	// secretKeys - values of these keys are redacted on dump
+	secretKeys = []string{"password", "secret", "token", "api_keys", "access_key", "secret_key", "private_key"}
+)
+
+type (
+	// document - a config yaml tree with interpolated values
+	document struct {
+		root yaml.Node
+		// secrets - values, which are read from secret files
+		secrets map[*yaml.Node]bool
+	}
+)
+
+// parse - reads a config file, expands ${VAR} and file: values and applies MOUNTAIN_* environment overrides
+func parse(content []byte, environ []string) (*document, error) {
+	doc := &document{secrets: make(map[*yaml.Node]bool)}
+	if err := yaml.NewDecoder(bytes.NewReader(content)).Decode(&doc.root); err != nil {
+		return nil, err
+	}
+
+	if err := doc.interpolate(&doc.root); err != nil {
+		return nil, err
+	}
+
+	doc.override(environ)
+	return doc, nil
+}
+
+func (doc *document) interpolate(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		for _, child := range node.Content {
+			if err := doc.interpolate(child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	value, err := expandEnv(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	if p, ok := strings.CutPrefix(value, FilePrefix); ok {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("line %d: secret file read err: %w", node.Line, err)
+		}
+
+		// a secret is always a string, even if it looks like a number
+		node.Value, node.Tag = strings.TrimRight(string(content), "\r\n"), "!!str"
+		doc.secrets[node] = true
+		return nil
+	}
+
+	if value != node.Value {
+		setScalar(node, value)
+	}
+
+	return nil
+}
+
+func expandEnv(value string) (string, error) {
+	var err error
+	expanded := envRe.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envRe.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+
+		err = fmt.Errorf("environment variable %s is not set", m[1])
+		return ref
+	})
+
+	return expanded, err
+}
+
+// override - applies MOUNTAIN_* variables, names are resolved by yaml tags of AppConfig,
+// so only struct sections can be overridden, not repositories or storages
+func (doc *document) override(environ []string) {
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		key, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok {
+			continue
+		}
+
+		keys, ok := envPath(reflect.TypeOf(AppConfig{}), strings.ToLower(key))
+		if !ok {
+			// orchestrators may set variables like MOUNTAIN_SERVICE_HOST by a service name
+			slog.Debug("environment variable does not match any config key, skipped", slog.String("name", name))
+			continue
+		}
+
+		setScalar(doc.lookup(keys), value)
+	}
+}
+
+// envPath - resolves listen_tls_cert_file to [listen tls cert_file]
+func envPath(t reflect.Type, name string) ([]string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		if name == key && isScalar(f.Type) {
+			return []string{key}, true
+		}
+
+		if rest, ok := strings.CutPrefix(name, key+"_"); ok {
+			if keys, ok := envPath(f.Type, rest); ok {
+				return append([]string{key}, keys...), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func isScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface:
+		return false
+	}
+
+	return true
+}
+
+// lookup - returns a value node by keys, missing mappings are created
+func (doc *document) lookup(keys []string) *yaml.Node {
+	if doc.root.Kind == 0 {
+		doc.root.Kind = yaml.DocumentNode
+	}
+
+	if len(doc.root.Content) == 0 {
+		doc.root.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	node := doc.root.Content[0]
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			// like an empty "tls:" section
+			*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+
+		node = next
+	}
+
+	return node
+}
+
+// setScalar - a type of a plain value is resolved again, so ${PORT} may become an int
+func setScalar(node *yaml.Node, value string) {
+	quoted := node.Kind == yaml.ScalarNode && node.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0
+	node.Kind, node.Value, node.Content = yaml.ScalarNode, value, nil
+	if !quoted {
+		node.Tag, node.Style = "", 0
+	}
+}
+
+// redact - hides values of secret files, secret keys and passwords of urls
+func (doc *document) redact(node *yaml.Node, secret bool) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if secret || doc.secrets[node] {
+			node.Value, node.Tag, node.Style = Redacted, "!!str", 0
+			return
+		}
+
+		if u, err := url.Parse(node.Value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				node.Value = u.Redacted()
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			doc.redact(node.Content[i+1], secret || isSecretKey(node.Content[i].Value))
+		}
+	default:
+		for _, child := range node.Content {
+			doc.redact(child, secret)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+
+	return false
+}
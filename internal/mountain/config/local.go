@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"lua-mountain/internal/mountain/auth"
 	"lua-mountain/internal/mountain/logging"
 	"lua-mountain/internal/mountain/repository"
 	"lua-mountain/internal/mountain/server"
@@ -20,6 +22,7 @@ type (
 		Logs logging.Config `yaml:"logs"`
 		Repositories []repository.Config `yaml:"repositories"`
 		Storages map[string]any `yaml:"storages"`
+		Auth auth.Config `yaml:"auth"`
 	}
 
 )
@@ -27,6 +30,7 @@ type (
 var (
 	DefaultSearchDirs []string
 	cfg               AppConfig
+	cfgPath           string
 )
 
 func init() {
@@ -46,6 +50,11 @@ func Get() *AppConfig {
 	return &cfg
 }
 
+// Path - path of a loaded config file, it is set even if a file has errors
+func Path() string {
+	return cfgPath
+}
+
 func Search(dirs ...string) (string, error) {
 	var (
 		filenames = []string{"config.yaml", "config.yml"}
@@ -74,24 +83,61 @@ func Search(dirs ...string) (string, error) {
 
 // Load - loads AppConfig struct from a single config file
 func Load(p string) error {
-	var (
-		file *os.File
-		err error
-	)
+	cfgPath = p
+	loaded, err := Read(p)
+	if err != nil {
+		return err
+	}
 
+	cfg = *loaded
+	return nil
+}
 
-	if file, err = os.Open(p); err != nil {
-		return err
+// Read - reads a config file into a new AppConfig, a loaded config is not changed.
+// Values are interpolated, see parse
+func Read(p string) (*AppConfig, error) {
+	doc, err := read(p)
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		decoder = yaml.NewDecoder(file)
-	)
+	var appCfg AppConfig
+	if err = doc.root.Decode(&appCfg); err != nil {
+		return nil, err
+	}
 
-	if err = decoder.Decode(&cfg); err != nil {
-		return err
+	return &appCfg, nil
+}
+
+// Dump - returns an interpolated config file with redacted secrets
+func Dump(p string) ([]byte, error) {
+	doc, err := read(p)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	doc.redact(&doc.root, false)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&doc.root); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
 }
 
+func read(p string) (*document, error) {
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parse(content, os.Environ())
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", p, err)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,382 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	pstorage "lua-mountain/pkg/storage"
+)
+
+type (
+	// Problem - a config error with a position in a config file
+	Problem struct {
+		File    string
+		Line    int
+		Message string
+	}
+
+	validator struct {
+		file     string
+		problems []Problem
+	}
+)
+
+var (
+	typeErrorRe     = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlUnmarshaler = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// Validate - decodes a config file strictly and checks storages and repositories.
+// An error is returned, when a file can not be read or parsed at all
+func Validate(p string) ([]Problem, error) {
+	doc, err := read(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc.root.Content) == 0 {
+		return []Problem{{File: p, Message: "config is empty"}}, nil
+	}
+
+	v := &validator{file: p}
+	root := doc.root.Content[0]
+	v.unknownKeys(root, reflect.TypeOf(AppConfig{}), "")
+
+	var appCfg AppConfig
+	var typeErr *yaml.TypeError
+	if err = doc.root.Decode(&appCfg); errors.As(err, &typeErr) {
+		v.typeErrors(typeErr, "")
+	} else if err != nil {
+		return nil, err
+	}
+
+	storages := v.storages(mappingValue(root, "storages"))
+	v.repositories(mappingValue(root, "repositories"), storages)
+
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		return a.Line - b.Line
+	})
+
+	return v.problems, nil
+}
+
+func (v *validator) addf(node *yaml.Node, format string, args ...any) {
+	v.problems = append(v.problems, Problem{File: v.file, Line: node.Line, Message: fmt.Sprintf(format, args...)})
+}
+
+// typeErrors - yaml errors look like "line 4: cannot unmarshal ..."
+func (v *validator) typeErrors(typeErr *yaml.TypeError, prefix string) {
+	for _, msg := range typeErr.Errors {
+		if m := typeErrorRe.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			v.problems = append(v.problems, Problem{File: v.file, Line: line, Message: prefix + m[2]})
+			continue
+		}
+
+		v.problems = append(v.problems, Problem{File: v.file, Message: prefix + msg})
+	}
+}
+
+// unknownKeys - reports mapping keys, which do not match yaml tags of t
+func (v *validator) unknownKeys(node *yaml.Node, t reflect.Type, section string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	custom := reflect.PointerTo(t).Implements(yamlUnmarshaler) || reflect.PointerTo(t).Implements(textUnmarshaler)
+	if custom && node.Kind != yaml.MappingNode {
+		// like lua_versions: ["5.4"] or permissions: ["rocks:read"]
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			f, ok := fieldByKey(t, key.Value)
+			if !ok {
+				if section == "" {
+					v.addf(key, "unknown key %q", key.Value)
+				} else {
+					v.addf(key, "unknown key %q in %s", key.Value, section)
+				}
+
+				continue
+			}
+
+			v.unknownKeys(value, f.Type, strings.TrimPrefix(section+"."+key.Value, "."))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+
+		for _, item := range node.Content {
+			v.unknownKeys(item, t.Elem(), section)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.unknownKeys(node.Content[i+1], t.Elem(), section+"."+node.Content[i].Value)
+		}
+	}
+}
+
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name == key {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// storages - checks storage sections by configs of registered drivers, returns names of valid storages
+func (v *validator) storages(node *yaml.Node) []string {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	names := make([]string, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i].Value, node.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			v.addf(value, "storage %s: a mapping is expected", name)
+			continue
+		}
+
+		typeNode := mappingValue(value, pstorage.TypeKey)
+		if typeNode == nil {
+			v.addf(value, "storage %s: type is required", name)
+			continue
+		}
+
+		driver, ok := pstorage.Lookup(typeNode.Value)
+		if !ok {
+			v.addf(typeNode, "storage %s: unsupported type %q, supported are %s",
+				name, typeNode.Value, strings.Join(pstorage.Drivers(), ", "))
+			continue
+		}
+
+		cfg := driver.NewConfig()
+		cfgType := reflect.TypeOf(cfg)
+		for cfgType.Kind() == reflect.Pointer {
+			cfgType = cfgType.Elem()
+		}
+
+		valid := true
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			key := value.Content[j]
+			if _, ok := fieldByKey(cfgType, key.Value); !ok && key.Value != pstorage.TypeKey {
+				v.addf(key, "storage %s: unknown key %q for type %s", name, key.Value, typeNode.Value)
+				valid = false
+			}
+		}
+
+		var typeErr *yaml.TypeError
+		if err := value.Decode(cfg); errors.As(err, &typeErr) {
+			v.typeErrors(typeErr, "storage "+name+": ")
+			continue
+		} else if err != nil {
+			v.addf(value, "storage %s: %s", name, err.Error())
+			continue
+		}
+
+		if err := cfg.Validate(); err != nil {
+			v.addf(value, "storage %s: %s", name, err.Error())
+			continue
+		}
+
+		if valid {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// repositories - checks prefixes, references to storages and members, extensions and api keys
+func (v *validator) repositories(node *yaml.Node, storages []string) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+
+	var (
+		prefixes = make(map[string]bool, len(node.Content))
+		apiKeys  = make(map[string]string, len(node.Content))
+		// anonymous - effective anonymous_read of repositories, groups are anonymous, when all members are
+		anonymous = make(map[string]bool, len(node.Content))
+		// groups - prefixes of all groups, storage repositories are created before them, so groups may
+		// refer to storage repositories in any order, but only to groups defined above
+		groups = make(map[string]bool, len(node.Content))
+	)
+
+	for _, repo := range node.Content {
+		prefixNode := mappingValue(repo, "prefix")
+		if prefixNode == nil || prefixNode.Value == "" {
+			continue
+		}
+
+		if members := mappingValue(repo, "members"); members != nil && len(members.Content) > 0 {
+			groups[prefixNode.Value] = true
+		} else if _, ok := anonymous[prefixNode.Value]; !ok {
+			anonymous[prefixNode.Value], _ = anonymousRead(repo)
+		}
+	}
+
+	for _, repo := range node.Content {
+		if repo.Kind != yaml.MappingNode {
+			continue
+		}
+
+		prefixNode := mappingValue(repo, "prefix")
+		if prefixNode == nil || prefixNode.Value == "" {
+			v.addf(repo, "repository: prefix is required")
+			continue
+		}
+
+		prefix := prefixNode.Value
+		if prefixes[prefix] {
+			v.addf(prefixNode, "repository %s: duplicate prefix", prefix)
+		}
+
+		members := mappingValue(repo, "members")
+		storageNode := mappingValue(repo, "storage")
+		if members != nil && len(members.Content) > 0 {
+			if storageNode != nil {
+				v.addf(storageNode, "repository %s: storage is ignored by groups", prefix)
+			}
+
+			groupAnonymous, anonymousNode := anonymousRead(repo)
+			anonymous[prefix] = groupAnonymous
+			for _, member := range members.Content {
+				_, known := anonymous[member.Value]
+				switch {
+				case member.Value == prefix:
+					v.addf(member, "repository %s: a group can not be a member of itself", prefix)
+				case groups[member.Value] && !prefixes[member.Value]:
+					v.addf(member, "repository %s: group %s is not defined above", prefix, member.Value)
+				case !groups[member.Value] && !known:
+					v.addf(member, "repository %s: member %s is not defined", prefix, member.Value)
+				case !anonymous[member.Value] && anonymousNode != nil && groupAnonymous:
+					v.addf(anonymousNode, "repository %s: anonymous_read is set, but member %s is private", prefix, member.Value)
+				}
+
+				anonymous[prefix] = anonymous[prefix] && anonymous[member.Value]
+			}
+		} else if storageNode == nil || storageNode.Value == "" {
+			v.addf(repo, "repository %s: storage is required", prefix)
+		} else if !slices.Contains(storages, storageNode.Value) {
+			v.addf(storageNode, "repository %s: storage %s is not defined or invalid", prefix, storageNode.Value)
+		}
+
+		if extensions := mappingValue(repo, "allowed_file_extensions"); extensions != nil {
+			if extensions.Kind == yaml.SequenceNode && len(extensions.Content) == 0 {
+				v.addf(extensions, "repository %s: allowed_file_extensions is empty, all files are rejected", prefix)
+			}
+
+			seen := make(map[string]bool, len(extensions.Content))
+			for _, ext := range extensions.Content {
+				switch {
+				case ext.Value == "":
+					v.addf(ext, "repository %s: empty extension allows any file", prefix)
+				case !isRockExtension(ext.Value):
+					v.addf(ext, "repository %s: extension %q does not match rockspec or rock files", prefix, ext.Value)
+				case seen[ext.Value]:
+					v.addf(ext, "repository %s: duplicate extension %q", prefix, ext.Value)
+				}
+
+				seen[ext.Value] = true
+			}
+		}
+
+		if upstream := mappingValue(repo, "upstream"); upstream != nil {
+			if u := mappingValue(upstream, "url"); u == nil {
+				v.addf(upstream, "repository %s: upstream url is required", prefix)
+			} else if err := pstorage.CheckURL(u.Value); err != nil {
+				v.addf(u, "repository %s: upstream url: %s", prefix, err.Error())
+			}
+		}
+
+		if keys := mappingValue(repo, "api_keys"); keys != nil {
+			for _, key := range keys.Content {
+				if key.Value == "" {
+					v.addf(key, "repository %s: empty api key", prefix)
+				} else if other, ok := apiKeys[key.Value]; ok {
+					v.addf(key, "repository %s: api key is already used by %s", prefix, other)
+				}
+
+				apiKeys[key.Value] = prefix
+			}
+		}
+
+		if htpasswd := mappingValue(repo, "htpasswd"); htpasswd != nil {
+			if file := mappingValue(htpasswd, "file"); file == nil || file.Value == "" {
+				v.addf(htpasswd, "repository %s: htpasswd file is required", prefix)
+			}
+
+			readUsers := mappingValue(htpasswd, "read_users")
+			if anonymous, node := anonymousRead(repo); anonymous && readUsers != nil && len(readUsers.Content) > 0 {
+				v.addf(node, "repository %s: anonymous_read is set, read_users of htpasswd do not restrict reading", prefix)
+			}
+		}
+
+		prefixes[prefix] = true
+	}
+}
+
+// anonymousRead - anonymous_read of a repository, it's true by default, but false for repositories with htpasswd.
+// A type error is reported by decoding of a whole config
+func anonymousRead(repo *yaml.Node) (bool, *yaml.Node) {
+	anonymous, node := mappingValue(repo, "htpasswd") == nil, mappingValue(repo, "anonymous_read")
+	if node != nil {
+		_ = node.Decode(&anonymous)
+	}
+
+	return anonymous, node
+}
+
+// isRockExtension - extensions are matched as suffixes, so "rock" and ".src.rock" are fine
+func isRockExtension(ext string) bool {
+	return strings.HasSuffix(".rockspec", ext) || strings.HasSuffix(".rock", ext) || strings.HasSuffix(ext, ".rock")
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
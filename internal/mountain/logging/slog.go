@@ -19,30 +19,34 @@ type (
 
 var (
 	DefaultLogger = slog.Default()
+	// target - opened log file, nil for stdout
+	target *os.File
 )
 
 func Init(cfg *Config) error {
 	var (
 		err     error
 		handler slog.Handler
-		target  *os.File
+		out     = os.Stdout
 	)
 
-	if cfg.Target == "" {
-		target = os.Stdout
-	} else if target, err = os.Open(cfg.Target); err != nil {
-		return err
+	if cfg.Target != "" {
+		if out, err = os.OpenFile(cfg.Target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+			return err
+		}
+
+		target = out
 	}
 
 	switch strings.ToLower(cfg.Format) {
 	case "json":
-		handler = slogan.NewJSONHandler(target, &slog.HandlerOptions{
+		handler = slogan.NewJSONHandler(out, &slog.HandlerOptions{
 			Level: cfg.Level,
 		}, repository.RequestIdContextKey)
 	case "text":
 		fallthrough
 	default:
-		handler = slogan.NewTextHandler(target, &slog.HandlerOptions{
+		handler = slogan.NewTextHandler(out, &slog.HandlerOptions{
 			Level: cfg.Level,
 		}, repository.RequestIdContextKey)
 	}
@@ -51,3 +55,19 @@ func Init(cfg *Config) error {
 	slog.SetDefault(DefaultLogger)
 	return nil
 }
+
+// Close - flushes and closes a log file, logs are written to stderr after it
+func Close() error {
+	if target == nil {
+		return nil
+	}
+
+	DefaultLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(DefaultLogger)
+
+	// sync is not supported by some targets, like pipes or /dev/stdout
+	_ = target.Sync()
+	err := target.Close()
+	target = nil
+	return err
+}
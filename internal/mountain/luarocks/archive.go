@@ -0,0 +1,284 @@
+package luarocks
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	RockManifestFilename = "rock_manifest"
+
+	// DefaultMaxRockEntries - max number of files in a rock archive
+	DefaultMaxRockEntries = 10000
+	// DefaultMaxRockUnpackedSize - max total size of unpacked rock files
+	DefaultMaxRockUnpackedSize = 1 << 30
+	// DefaultMaxCompressionRatio - max ratio of unpacked and packed sizes of a single file, protects from zip bombs
+	DefaultMaxCompressionRatio = 200
+	// maxMetadataSize - max size of rockspec and rock_manifest files
+	maxMetadataSize = 1 << 20
+)
+
+type (
+	// RockArchive - checked content of a .rock file
+	RockArchive struct {
+		Name     string
+		Version  string
+		Arch     string
+		Rockspec *Rockspec
+		// Manifest - flat rock_manifest: file path => md5, src rocks have no rock_manifest
+		Manifest map[string]string
+	}
+
+	ArchiveLimits struct {
+		MaxEntries          int
+		MaxUnpackedSize     uint64
+		MaxCompressionRatio uint64
+	}
+)
+
+var (
+	DefaultArchiveLimits = ArchiveLimits{
+		MaxEntries:          DefaultMaxRockEntries,
+		MaxUnpackedSize:     DefaultMaxRockUnpackedSize,
+		MaxCompressionRatio: DefaultMaxCompressionRatio,
+	}
+)
+
+// OpenRock - opens a rock archive and checks it: sizes and paths of entries, a rockspec inside,
+// rock_manifest checksums, name, version and arch from a filename
+func OpenRock(ctx context.Context, r io.ReaderAt, size int64, filename string, limits ArchiveLimits) (*RockArchive, error) {
+	name, version, arch, err := ParseFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if arch == "rockspec" {
+		return nil, fmt.Errorf("%s is not a rock archive", filename)
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("bad zip archive: %w", err)
+	}
+
+	if err = checkEntries(zr.File, limits); err != nil {
+		return nil, err
+	}
+
+	archive := &RockArchive{Name: name, Version: version, Arch: arch}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	specFilename := name + "-" + version + ".rockspec"
+	specFile, ok := files[specFilename]
+	if !ok {
+		return nil, fmt.Errorf("rockspec %s not found in archive", specFilename)
+	}
+
+	specContent, err := readEntry(specFile, maxMetadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.Rockspec, err = ParseRockspec(ctx, bytes.NewReader(specContent)); err != nil {
+		return nil, fmt.Errorf("%s: %w", specFilename, err)
+	}
+
+	if err = archive.Rockspec.Validate(specFilename); err != nil {
+		return nil, fmt.Errorf("%s: %w", specFilename, err)
+	}
+
+	manifestFile, ok := files[RockManifestFilename]
+	if !ok {
+		// source rocks contain only a rockspec and sources
+		if arch == "src" {
+			return archive, nil
+		}
+
+		return nil, fmt.Errorf("%s not found in archive", RockManifestFilename)
+	}
+
+	if archive.Manifest, err = readRockManifest(ctx, manifestFile); err != nil {
+		return nil, err
+	}
+
+	for p, sum := range archive.Manifest {
+		f, ok := files[p]
+		if !ok {
+			return nil, fmt.Errorf("%s: file %s not found in archive", RockManifestFilename, p)
+		}
+
+		if err = checkMD5(f, sum, limits.MaxUnpackedSize); err != nil {
+			return nil, err
+		}
+
+		if arch == "all" && strings.HasPrefix(p, "lib/") {
+			return nil, fmt.Errorf("arch all rock contains a native library %s", p)
+		}
+	}
+
+	return archive, nil
+}
+
+// checkEntries - rejects path traversal, links and archives, which are too big after unpacking
+func checkEntries(entries []*zip.File, limits ArchiveLimits) error {
+	if len(entries) > limits.MaxEntries {
+		return fmt.Errorf("archive contains %d files, max allowed %d", len(entries), limits.MaxEntries)
+	}
+
+	var (
+		total uint64
+		seen  = make(map[string]struct{}, len(entries))
+	)
+
+	for _, f := range entries {
+		if !isSafePath(f.Name) {
+			return fmt.Errorf("archive entry %q has unsafe path", f.Name)
+		}
+
+		if _, ok := seen[f.Name]; ok {
+			return fmt.Errorf("archive entry %q is duplicated", f.Name)
+		}
+		seen[f.Name] = struct{}{}
+
+		if mode := f.Mode(); !mode.IsRegular() && !mode.IsDir() {
+			return fmt.Errorf("archive entry %q is not a regular file", f.Name)
+		}
+
+		if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > limits.MaxCompressionRatio {
+			return fmt.Errorf("archive entry %q compression ratio is too high", f.Name)
+		}
+
+		total += f.UncompressedSize64
+		if total > limits.MaxUnpackedSize {
+			return fmt.Errorf("unpacked archive size exceeds %d bytes", limits.MaxUnpackedSize)
+		}
+	}
+
+	return nil
+}
+
+func isSafePath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\\\x00") || strings.Contains(p, ":") {
+		return false
+	}
+
+	for _, segment := range strings.Split(strings.TrimSuffix(p, "/"), "/") {
+		if segment == ".." || segment == "." || segment == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readEntry - reads a whole entry, sizes in zip headers are not trusted
+func readEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", f.Name, err)
+	}
+
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s exceeds %d bytes", f.Name, limit)
+	}
+
+	return content, nil
+}
+
+func checkMD5(f *zip.File, expected string, limit uint64) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	h := md5.New()
+	n, err := io.Copy(h, io.LimitReader(rc, int64(limit)+1))
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", f.Name, err)
+	}
+
+	if uint64(n) > limit {
+		return fmt.Errorf("%s exceeds %d bytes", f.Name, limit)
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%s: md5 mismatch of %s: expected %s, got %s", RockManifestFilename, f.Name, expected, actual)
+	}
+
+	return nil
+}
+
+// readRockManifest - evaluates rock_manifest and flattens its tree: {lua = {foo = {["bar.lua"] = md5}}} => lua/foo/bar.lua
+func readRockManifest(ctx context.Context, f *zip.File) (map[string]string, error) {
+	content, err := readEntry(f, maxMetadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	globals, err := Eval(ctx, bytes.NewReader(content), RockManifestFilename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", RockManifestFilename, err)
+	}
+
+	tree := tableTable(globals, "rock_manifest")
+	if tree == nil {
+		return nil, fmt.Errorf("%s: rock_manifest table is not defined", RockManifestFilename)
+	}
+
+	sums := make(map[string]string, 10)
+	var walk func(prefix string, t *lua.LTable) error
+	walk = func(prefix string, t *lua.LTable) (wErr error) {
+		t.ForEach(func(k lua.LValue, v lua.LValue) {
+			if wErr != nil {
+				return
+			}
+
+			key, ok := k.(lua.LString)
+			if !ok {
+				wErr = fmt.Errorf("%s: bad key %s", RockManifestFilename, k.String())
+				return
+			}
+
+			p := prefix + string(key)
+			switch v := v.(type) {
+			case lua.LString:
+				sums[p] = string(v)
+			case *lua.LTable:
+				wErr = walk(p+"/", v)
+			default:
+				wErr = fmt.Errorf("%s: bad value of %s", RockManifestFilename, p)
+			}
+		})
+
+		return
+	}
+
+	if err = walk("", tree); err != nil {
+		return nil, err
+	}
+
+	if len(sums) == 0 {
+		return nil, errors.New("rock_manifest is empty")
+	}
+
+	return sums, nil
+}
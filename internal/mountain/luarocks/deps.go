@@ -0,0 +1,155 @@
+package luarocks
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	// Dependency - parsed rockspec dependency, like "lua >= 5.1, < 5.4"
+	Dependency struct {
+		Name        string
+		Constraints []Constraint
+	}
+
+	Constraint struct {
+		Op      string
+		Version *ParsedVersion
+	}
+)
+
+var (
+	dependencyRegexp = regexp.MustCompile(`^\s*([a-zA-Z0-9.\-_/]*)\s*(.*)$`)
+	constraintRegexp = regexp.MustCompile(`^(@?)([<>=~!]*)\s*([a-zA-Z0-9._\-]+)[\s,]*(.*)$`)
+	// constraintOperators - luarocks aliases of operators
+	constraintOperators = map[string]string{
+		"==": "==",
+		"~=": "~=",
+		">":  ">",
+		"<":  "<",
+		">=": ">=",
+		"<=": "<=",
+		"~>": "~>",
+		"":   "==",
+		"=":  "==",
+		"!=": "~=",
+	}
+)
+
+// ParseDependency - parses a dependency string like luarocks.deps.parse_dep does
+func ParseDependency(s string) (*Dependency, error) {
+	match := dependencyRegexp.FindStringSubmatch(s)
+	if match == nil || match[1] == "" {
+		return nil, fmt.Errorf("bad dependency %q: name is required", s)
+	}
+
+	dep := &Dependency{Name: strings.ToLower(match[1])}
+	rest := match[2]
+	for rest != "" {
+		cMatch := constraintRegexp.FindStringSubmatch(rest)
+		if cMatch == nil {
+			return nil, fmt.Errorf("bad dependency %q: unable to parse constraint %q", s, rest)
+		}
+
+		op, ok := constraintOperators[cMatch[2]]
+		if !ok {
+			return nil, fmt.Errorf("bad dependency %q: bad constraint operator %q", s, cMatch[2])
+		}
+
+		dep.Constraints = append(dep.Constraints, Constraint{Op: op, Version: ParseVersion(cMatch[3])})
+		rest = cMatch[4]
+	}
+
+	return dep, nil
+}
+
+// Match - checks that a version satisfies all constraints, like luarocks.core.vers.match_constraints
+func (d *Dependency) Match(v *ParsedVersion) bool {
+	for _, c := range d.Constraints {
+		if !c.Match(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c Constraint) Match(v *ParsedVersion) bool {
+	switch c.Op {
+	case "==":
+		return v.Equal(c.Version)
+	case "~=":
+		return !v.Equal(c.Version)
+	case ">":
+		return c.Version.Compare(v) < 0
+	case "<":
+		return v.Compare(c.Version) < 0
+	case ">=":
+		return c.Version.Compare(v) <= 0
+	case "<=":
+		return v.Compare(c.Version) <= 0
+	case "~>":
+		return partialMatch(v, c.Version)
+	}
+
+	return false
+}
+
+// partialMatch - pessimistic operator, version must start with all parts of a requested one
+func partialMatch(v, requested *ParsedVersion) bool {
+	for i, part := range requested.Parts {
+		var vPart float64
+		if i < len(v.Parts) {
+			vPart = v.Parts[i]
+		}
+
+		if part != vPart {
+			return false
+		}
+	}
+
+	if requested.HasRevision {
+		return v.HasRevision && requested.Revision == v.Revision
+	}
+
+	return true
+}
+
+// FilterByLua - returns a list without versions, which lua dependency does not match a lua version,
+// like luarocks-admin does for versioned manifests. Versions without known dependencies are kept
+func (rl RocksList) FilterByLua(luaVersion string) RocksList {
+	var (
+		lv       = ParseVersion(luaVersion)
+		filtered = make(RocksList, 0, len(rl))
+	)
+
+	for _, rock := range rl {
+		versions := make([]*Version, 0, len(rock.Versions))
+		for _, version := range rock.Versions {
+			if version.MatchLua(lv) {
+				versions = append(versions, version)
+			}
+		}
+
+		if len(versions) > 0 {
+			filtered = append(filtered, &Rock{Name: rock.Name, Versions: versions})
+		}
+	}
+
+	return filtered
+}
+
+// MatchLua - checks a lua dependency of a version, broken dependencies are ignored
+func (v *Version) MatchLua(lv *ParsedVersion) bool {
+	for _, s := range v.Dependencies {
+		dep, err := ParseDependency(s)
+		if err != nil || dep.Name != "lua" {
+			continue
+		}
+
+		return dep.Match(lv)
+	}
+
+	return true
+}
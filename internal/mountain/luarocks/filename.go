@@ -0,0 +1,29 @@
+package luarocks
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// rockFilenameRegexp - luarocks.path.parse_name grammar: name-version-revision.arch.rock
+	rockFilenameRegexp = regexp.MustCompile(`^(.*)-([^-]+-\d+)\.([^.]+)\.rock$`)
+	// rockspecFilenameRegexp - name-version-revision.rockspec
+	rockspecFilenameRegexp = regexp.MustCompile(`^(.*)-([^-]+-\d+)\.(rockspec)$`)
+)
+
+// ParseFilename - splits a rock or a rockspec filename into name, version with revision and arch.
+// Arch of rockspecs is "rockspec", like in manifests
+func ParseFilename(filename string) (name, version, arch string, err error) {
+	match := rockFilenameRegexp.FindStringSubmatch(filename)
+	if match == nil {
+		match = rockspecFilenameRegexp.FindStringSubmatch(filename)
+	}
+
+	if match == nil || match[1] == "" {
+		return "", "", "", fmt.Errorf("filename %s does not match name-version-revision.arch.rock or "+
+			"name-version-revision.rockspec", filename)
+	}
+
+	return match[1], match[2], match[3], nil
+}
@@ -0,0 +1,61 @@
+package luarocks
+
+import "testing"
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		filename, name, version, arch string
+	}{
+		{"lua-cjson-2.1.0-1.rockspec", "lua-cjson", "2.1.0-1", "rockspec"},
+		{"lua-cjson-2.1.0-1.src.rock", "lua-cjson", "2.1.0-1", "src"},
+		{"penlight-1.13.1-1.all.rock", "penlight", "1.13.1-1", "all"},
+		{"luasocket-3.0rc1-2.linux-x86_64.rock", "luasocket", "3.0rc1-2", "linux-x86_64"},
+		{"lpeg-1.0-1.macosx-aarch64.rock", "lpeg", "1.0-1", "macosx-aarch64"},
+		{"x-2.3.4.5-2.src.rock", "x", "2.3.4.5-2", "src"},
+		{"busted-scm-1.rockspec", "busted", "scm-1", "rockspec"},
+		{"busted-dev-12.src.rock", "busted", "dev-12", "src"},
+		// a name may contain dashes and dots
+		{"lua-resty-http.v2-0.17.1-0.rockspec", "lua-resty-http.v2", "0.17.1-0", "rockspec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			name, version, arch, err := ParseFilename(tt.filename)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if name != tt.name || version != tt.version || arch != tt.arch {
+				t.Errorf("got %q %q %q, want %q %q %q", name, version, arch, tt.name, tt.version, tt.arch)
+			}
+		})
+	}
+}
+
+func TestParseFilenameRejects(t *testing.T) {
+	tests := []string{
+		"",
+		"manifest",
+		"README.md",
+		"foo.rockspec",
+		// no revision
+		"foo-1.0.rockspec",
+		"foo-1.0.src.rock",
+		"foo-1.0-x.rockspec",
+		// no arch
+		"foo-1.0-1.rock",
+		// no name
+		"-1.0-1.rockspec",
+		"-1.0-1.src.rock",
+		"foo-1.0-1.rockspec.zip",
+		"foo-1.0-1.src.rock.bak",
+	}
+
+	for _, filename := range tests {
+		t.Run(filename, func(t *testing.T) {
+			if name, version, arch, err := ParseFilename(filename); err == nil {
+				t.Errorf("%q is parsed as %q %q %q, an error is expected", filename, name, version, arch)
+			}
+		})
+	}
+}
@@ -13,27 +13,59 @@ type (
 	
 	RocksList []*Rock
 )
-func (rl *RocksList) Add(rockName, version, arch string) {
-	rock := rl.Search(rockName)
+// Add - adds a rock version with an arch into a sorted list, returns the version entry
+func (rl *RocksList) Add(rockName, version, arch string) *Version {
 	crl := *rl
-	if rock == nil {
-		rock = &Rock{Name: rockName, Versions: make([]*Version, 0, 3)}
-		crl = append(crl, rock)
+	pos, found := slices.BinarySearchFunc(crl, rockName, func(rock *Rock, s string) int {
+		return cmp.Compare(rock.Name, s)
+	})
+
+	if !found {
+		crl = slices.Insert(crl, pos, &Rock{Name: rockName, Versions: make([]*Version, 0, 3)})
 	}
 
+	rock := crl[pos]
 	v := rock.SearchVersion(version)
 	if v == nil {
-		v = &Version{version, make([]string, 0, 3)}
+		v = &Version{Name: version, Arch: make([]string, 0, 3)}
 		v.AddArch(arch)
 		rock.AddVersion(v)
 	} else if !v.HasArch(arch) {
 		v.AddArch(arch)
 	}
 
-	slices.SortFunc(crl, func(a, b *Rock) int {
-		return cmp.Compare(a.Name, b.Name)
-	})
 	*rl = crl
+	return v
+}
+
+// Merge - adds all rocks, versions and arches from another list
+func (rl *RocksList) Merge(other RocksList) {
+	var (
+		rock    *Rock
+		version *Version
+		arch    string
+	)
+
+	for _, rock = range other {
+		for _, version = range rock.Versions {
+			var v *Version
+			for _, arch = range version.Arch {
+				v = rl.Add(rock.Name, version.Name, arch)
+			}
+
+			if v == nil {
+				continue
+			}
+
+			if v.Dependencies == nil {
+				v.Dependencies = version.Dependencies
+			}
+
+			if v.Modules == nil && v.Commands == nil {
+				v.Modules, v.Commands = version.Modules, version.Commands
+			}
+		}
+	}
 }
 
 func (rl *RocksList) Search(rockName string) *Rock {
@@ -66,9 +98,7 @@ func (p *Rock) SearchVersion(v string) *Version {
 		return nil
 	}
 
-	pos, found := slices.BinarySearchFunc(p.Versions, v, func(version *Version, s string) int {
-		return cmp.Compare(version.Name, s)
-	})
+	pos, found := slices.BinarySearchFunc(p.Versions, &Version{Name: v}, VersionCmpFunc)
 	if !found {
 		return nil
 	}
@@ -77,6 +107,6 @@ func (p *Rock) SearchVersion(v string) *Version {
 }
 
 func (p *Rock) AddVersion(v *Version) {
-	p.Versions = append(p.Versions, v)
-	slices.SortFunc(p.Versions, VersionCmpFunc)
+	pos, _ := slices.BinarySearchFunc(p.Versions, v, VersionCmpFunc)
+	p.Versions = slices.Insert(p.Versions, pos, v)
 }
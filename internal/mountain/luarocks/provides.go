@@ -0,0 +1,152 @@
+package luarocks
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+type (
+	// Provides - lua modules and commands, installed by a rock
+	Provides struct {
+		Modules  []string
+		Commands []string
+	}
+
+	// Index - module or command name => rocks, which provide it (name/version)
+	Index map[string][]string
+)
+
+var (
+	// moduleExtensions - extensions of installed modules in lua/ and lib/ dirs of a rock
+	moduleExtensions = []string{".lua", ".so", ".dll", ".dylib"}
+)
+
+// Provides - returns installed modules and commands, listed in rock_manifest.
+// Source rocks have no rock_manifest, so their rockspec is used
+func (a *RockArchive) Provides() Provides {
+	if a.Manifest == nil {
+		return a.Rockspec.Provides
+	}
+
+	var p Provides
+	for file := range a.Manifest {
+		dir, rest, found := strings.Cut(file, "/")
+		if !found {
+			continue
+		}
+
+		switch dir {
+		case "lua", "lib":
+			if module, ok := PathToModule(rest); ok {
+				p.Modules = append(p.Modules, module)
+			}
+		case "bin":
+			p.Commands = append(p.Commands, path.Base(rest))
+		}
+	}
+
+	p.normalize()
+	return p
+}
+
+// Merge - adds modules and commands of other
+func (p *Provides) Merge(other Provides) {
+	p.Modules = append(p.Modules, other.Modules...)
+	p.Commands = append(p.Commands, other.Commands...)
+	p.normalize()
+}
+
+func (p *Provides) normalize() {
+	slices.Sort(p.Modules)
+	p.Modules = slices.Compact(p.Modules)
+	slices.Sort(p.Commands)
+	p.Commands = slices.Compact(p.Commands)
+}
+
+// PathToModule - converts an installed file path to a module name: socket/http.lua => socket.http
+func PathToModule(p string) (string, bool) {
+	for _, ext := range moduleExtensions {
+		if name, found := strings.CutSuffix(p, ext); found && name != "" {
+			return strings.ReplaceAll(name, "/", "."), true
+		}
+	}
+
+	return "", false
+}
+
+// rockspecProvides - reads modules from build.modules and build.install.{lua,lib},
+// commands from build.install.bin
+func rockspecProvides(build *lua.LTable) Provides {
+	var p Provides
+	if build == nil {
+		return p
+	}
+
+	p.Modules = append(p.Modules, tableKeys(tableTable(build, "modules"))...)
+	if install := tableTable(build, "install"); install != nil {
+		p.Modules = append(p.Modules, tableKeys(tableTable(install, "lua"))...)
+		p.Modules = append(p.Modules, tableKeys(tableTable(install, "lib"))...)
+
+		// bin = {"bin/cmd"} installs bin/cmd as cmd, bin = {name = "bin/cmd"} installs it as name
+		bin := tableTable(install, "bin")
+		p.Commands = append(p.Commands, tableKeys(bin)...)
+		for _, file := range tableStrings(bin) {
+			p.Commands = append(p.Commands, path.Base(file))
+		}
+	}
+
+	p.normalize()
+	return p
+}
+
+// tableKeys - returns string keys of a hash part of a table
+func tableKeys(t *lua.LTable) []string {
+	if t == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, 5)
+	t.ForEach(func(k lua.LValue, _ lua.LValue) {
+		if s, ok := k.(lua.LString); ok {
+			keys = append(keys, string(s))
+		}
+	})
+
+	return keys
+}
+
+// Indexes - builds modules and commands indexes of a manifest
+func (rl RocksList) Indexes() (modules Index, commands Index) {
+	modules = make(Index, 10)
+	commands = make(Index, 10)
+	for _, rock := range rl {
+		for _, version := range rock.Versions {
+			id := rock.Name + "/" + version.Name
+			for _, module := range version.Modules {
+				modules[module] = append(modules[module], id)
+			}
+
+			for _, command := range version.Commands {
+				commands[command] = append(commands[command], id)
+			}
+		}
+	}
+
+	return
+}
+
+// LookupModule - returns rocks, which provide a module. A module is also searched with .init suffix,
+// because require("foo") loads foo/init.lua
+func (idx Index) LookupModule(name string) []string {
+	rocks := slices.Clone(idx[name])
+	for _, rock := range idx[name+".init"] {
+		if !slices.Contains(rocks, rock) {
+			rocks = append(rocks, rock)
+		}
+	}
+
+	return rocks
+}
@@ -0,0 +1,60 @@
+package luarocks
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ReadManifest - reads a lua manifest (repository table only) into RocksList
+func ReadManifest(ctx context.Context, r io.Reader) (RocksList, error) {
+	globals, err := Eval(ctx, r, "manifest")
+	if err != nil {
+		return nil, err
+	}
+
+	repository := tableTable(globals, "repository")
+	if repository == nil {
+		return nil, errors.New("manifest err: repository table not found")
+	}
+
+	list := make(RocksList, 0, repository.Len())
+	repository.ForEach(func(name lua.LValue, versions lua.LValue) {
+		rockName, ok := name.(lua.LString)
+		if !ok {
+			return
+		}
+
+		vTable, ok := versions.(*lua.LTable)
+		if !ok {
+			return
+		}
+
+		vTable.ForEach(func(version lua.LValue, items lua.LValue) {
+			versionName, ok := version.(lua.LString)
+			if !ok {
+				return
+			}
+
+			iTable, ok := items.(*lua.LTable)
+			if !ok {
+				return
+			}
+
+			iTable.ForEach(func(_ lua.LValue, item lua.LValue) {
+				if entry, ok := item.(*lua.LTable); ok {
+					if arch := tableString(entry, "arch"); arch != "" {
+						v := list.Add(string(rockName), string(versionName), arch)
+						if deps := tableStrings(tableTable(entry, "dependencies")); len(deps) > 0 {
+							v.Dependencies = deps
+						}
+					}
+				}
+			})
+		})
+	})
+
+	return list, nil
+}
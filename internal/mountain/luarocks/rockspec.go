@@ -0,0 +1,127 @@
+package luarocks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// MaxRockspecSize - rockspecs are evaluated, larger ones are rejected before an evaluation
+	MaxRockspecSize = 256 * 1024
+)
+
+var (
+	SupportedRockspecFormats = []string{"1.0", "1.1", "3.0"}
+)
+
+type (
+	// Rockspec - rockspec fields, needed by a rocks server
+	Rockspec struct {
+		RockspecFormat    string
+		Package           string
+		Version           string
+		SourceURL         string
+		Dependencies      []string
+		BuildDependencies []string
+		// Provides - modules and commands from a build table
+		Provides Provides
+	}
+)
+
+// ParseRockspec - evaluates a rockspec in a sandbox and reads its fields
+func ParseRockspec(ctx context.Context, r io.Reader) (*Rockspec, error) {
+	content, err := io.ReadAll(io.LimitReader(r, MaxRockspecSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("rockspec read err: %w", err)
+	}
+
+	if len(content) > MaxRockspecSize {
+		return nil, fmt.Errorf("rockspec err: max allowed size %d", MaxRockspecSize)
+	}
+
+	globals, err := Eval(ctx, bytes.NewReader(content), "rockspec")
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Rockspec{
+		RockspecFormat:    tableString(globals, "rockspec_format"),
+		Package:           tableString(globals, "package"),
+		Version:           tableString(globals, "version"),
+		Dependencies:      tableStrings(tableTable(globals, "dependencies")),
+		BuildDependencies: tableStrings(tableTable(globals, "build_dependencies")),
+		Provides:          rockspecProvides(tableTable(globals, "build")),
+	}
+
+	if source := tableTable(globals, "source"); source != nil {
+		spec.SourceURL = tableString(source, "url")
+	}
+
+	if spec.Package == "" {
+		return nil, errors.New("rockspec err: package is not defined")
+	}
+
+	if spec.Version == "" {
+		return nil, errors.New("rockspec err: version is not defined")
+	}
+
+	return spec, nil
+}
+
+// tableStrings - returns string values of an array part of a table
+func tableStrings(t *lua.LTable) []string {
+	if t == nil {
+		return nil
+	}
+
+	values := make([]string, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		if s, ok := t.RawGetInt(i).(lua.LString); ok {
+			values = append(values, string(s))
+		}
+	}
+
+	return values
+}
+
+// Validate - checks required fields of a rockspec and its filename (name-version.rockspec)
+func (spec *Rockspec) Validate(filename string) error {
+	if spec.RockspecFormat != "" && !slices.Contains(SupportedRockspecFormats, spec.RockspecFormat) {
+		return fmt.Errorf("rockspec_format %q is not supported, supported are: %v",
+			spec.RockspecFormat, SupportedRockspecFormats,
+		)
+	}
+
+	if spec.SourceURL == "" {
+		return errors.New("source.url is not defined")
+	}
+
+	name, version, _, err := ParseFilename(filename)
+	if err != nil {
+		return err
+	}
+
+	// luarocks names rockspec files by a lowercased package name
+	if name != strings.ToLower(spec.Package) {
+		return fmt.Errorf("package %q does not match filename %s", spec.Package, filename)
+	}
+
+	if version != spec.Version {
+		return fmt.Errorf("version %q does not match filename %s", spec.Version, filename)
+	}
+
+	for _, dep := range slices.Concat(spec.Dependencies, spec.BuildDependencies) {
+		if _, err = ParseDependency(dep); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
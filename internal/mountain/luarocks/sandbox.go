@@ -0,0 +1,154 @@
+package luarocks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	DefaultEvalTimeout = time.Second
+	evalCallStackSize  = 64
+	evalRegistrySize   = 1024 * 4
+	evalRegistryMax    = 1024 * 1024
+	// evalBaseBudget, evalBudgetPerByte - a budget of a chunk: a base and a budget per byte of a source,
+	// a data chunk needs a few instructions per table or string of its source
+	evalBaseBudget    = 100_000
+	evalBudgetPerByte = 4
+	// evalMaxString - a max length of a string in registers, strings can't grow beyond it by concatenation
+	evalMaxString = 64 * 1024
+	// evalStringCost - a string in registers costs an instruction per evalStringCost bytes,
+	// so a loop of concatenations runs out of a budget long before it allocates much
+	evalStringCost = 64
+)
+
+var (
+	ErrEvalLimit = errors.New("lua eval limit is exceeded")
+)
+
+type (
+	// evalBudget - a context of a lua state, which is checked by the VM before every instruction.
+	// Stack limits don't restrict heap allocations of tables and strings, so instructions
+	// and strings in registers are charged from a budget, Done is closed, when it's exhausted
+	evalBudget struct {
+		context.Context
+		L        *lua.LState
+		budget   int
+		exceeded error
+		closed   chan struct{}
+	}
+)
+
+// Eval - runs a lua chunk (manifest, rockspec, rock_manifest) in an empty environment:
+// no standard libraries are opened, so the chunk can only build tables and strings.
+// Returns a table with globals defined by the chunk. Chunks run with a budget of instructions
+// proportional to a source size, chunks exceeding it fail with ErrEvalLimit
+func Eval(ctx context.Context, r io.Reader, name string) (*lua.LTable, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("lua read err: %w", err)
+	}
+
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   evalCallStackSize,
+		RegistrySize:    evalRegistrySize,
+		RegistryMaxSize: evalRegistryMax,
+	})
+	defer L.Close()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var done context.CancelFunc
+		ctx, done = context.WithTimeout(ctx, DefaultEvalTimeout)
+		defer done()
+	}
+	budget := newEvalBudget(ctx, L, evalBaseBudget+evalBudgetPerByte*len(src))
+	L.SetContext(budget)
+
+	fn, err := L.Load(bytes.NewReader(src), name)
+	if err != nil {
+		return nil, fmt.Errorf("lua syntax err: %w", err)
+	}
+
+	L.Push(fn)
+	if err = L.PCall(0, 0, nil); err != nil {
+		if budget.exceeded != nil {
+			return nil, fmt.Errorf("lua eval err: %w", budget.exceeded)
+		}
+
+		// a timeout or a cancellation is raised as a lua error, callers tell it from broken chunks
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("lua eval err: %w", ctxErr)
+		}
+
+		return nil, fmt.Errorf("lua eval err: %w", err)
+	}
+
+	return L.G.Global, nil
+}
+
+func newEvalBudget(ctx context.Context, L *lua.LState, budget int) *evalBudget {
+	closed := make(chan struct{})
+	close(closed)
+	return &evalBudget{Context: ctx, L: L, budget: budget, closed: closed}
+}
+
+// Done - charges an instruction and strings in registers of a current frame
+func (b *evalBudget) Done() <-chan struct{} {
+	if b.exceeded != nil {
+		return b.closed
+	}
+
+	b.budget--
+	for i := 1; i <= b.L.GetTop(); i++ {
+		s, ok := b.L.Get(i).(lua.LString)
+		if !ok {
+			continue
+		}
+
+		if len(s) > evalMaxString {
+			b.exceeded = fmt.Errorf("%w: string of %d bytes, max %d", ErrEvalLimit, len(s), evalMaxString)
+			return b.closed
+		}
+
+		b.budget -= len(s) / evalStringCost
+	}
+
+	if b.budget < 0 {
+		b.exceeded = fmt.Errorf("%w: too many instructions", ErrEvalLimit)
+		return b.closed
+	}
+
+	return b.Context.Done()
+}
+
+func (b *evalBudget) Err() error {
+	if b.exceeded != nil {
+		return b.exceeded
+	}
+
+	return b.Context.Err()
+}
+
+// tableString - returns a string value by key or empty string for other types
+func tableString(t *lua.LTable, key string) string {
+	if s, ok := t.RawGetString(key).(lua.LString); ok {
+		return string(s)
+	}
+
+	return ""
+}
+
+// tableTable - returns a nested table by key or nil
+func tableTable(t *lua.LTable, key string) *lua.LTable {
+	if tbl, ok := t.RawGetString(key).(*lua.LTable); ok {
+		return tbl
+	}
+
+	return nil
+}
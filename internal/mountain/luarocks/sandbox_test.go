@@ -0,0 +1,75 @@
+package luarocks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalLimits(t *testing.T) {
+	tests := []struct {
+		name, chunk string
+	}{
+		{"tables", `local t = {} for i = 1, 1e8 do t[i] = {} end`},
+		{"string doubling", `local s = "x" while true do s = s .. s end`},
+		{"strings", `t = {} s = "` + strings.Repeat("x", 1024) + `" for i = 1, 5 do s = s .. s end for i = 1, 1e8 do t[i] = s .. i end`},
+		{"endless loop", `while true do end`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a deadline is far, a chunk must be stopped by a budget
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			start := time.Now()
+			_, err := Eval(ctx, strings.NewReader(tt.chunk), "chunk")
+			if !errors.Is(err, ErrEvalLimit) {
+				t.Fatalf("got %v, want ErrEvalLimit", err)
+			}
+
+			if errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("a limit must not be reported as a timeout: %v", err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("chunk is stopped after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestEvalManifest(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("repository = {\n")
+	for i := 0; i < 2000; i++ {
+		sb.WriteString(`  ["rock-` + strings.Repeat("x", i%50) + `"] = {["1.0-1"] = {{arch = "rockspec"}, {arch = "src", dependencies = {"lua >= 5.1"}}}},` + "\n")
+	}
+	sb.WriteString("}\n")
+
+	list, err := ReadManifest(context.Background(), strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("a large data chunk must fit a budget: %v", err)
+	}
+
+	if len(list) != 50 {
+		t.Errorf("got %d rocks, want 50", len(list))
+	}
+}
+
+func TestParseRockspecSize(t *testing.T) {
+	spec := `package = "foo"
+version = "1.0-1"
+source = {url = "https://example.com/foo-1.0-1.tar.gz"}
+`
+	if _, err := ParseRockspec(context.Background(), strings.NewReader(spec)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	padded := spec + "-- " + strings.Repeat("x", MaxRockspecSize) + "\n"
+	if _, err := ParseRockspec(context.Background(), strings.NewReader(padded)); err == nil {
+		t.Fatal("rockspec larger than MaxRockspecSize is parsed")
+	}
+}
@@ -1,13 +1,46 @@
 package luarocks
 
-import "slices"
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
 type (
 	Version struct {
 		Name string
 		Arch []string
+		// Dependencies - rockspec dependencies, like "lua >= 5.1"
+		Dependencies []string `json:",omitempty"`
+		// Modules, Commands - installed by rockspec or rock files of a version
+		Modules  []string `json:",omitempty"`
+		Commands []string `json:",omitempty"`
+		parsed   *ParsedVersion
 	}
 
+	// ParsedVersion - version representation by luarocks rules (luarocks.core.vers.parse_version):
+	// numbers and words are parts of a version, revision is a last number after a dash
+	ParsedVersion struct {
+		String      string
+		Parts       []float64
+		Revision    int
+		HasRevision bool
+	}
+)
+
+var (
+	// versionDeltas - weights of special words in versions, dev and scm versions are newer than any release
+	versionDeltas = map[string]float64{
+		"dev":   120000000,
+		"scm":   110000000,
+		"cvs":   100000000,
+		"rc":    -1000,
+		"pre":   -10000,
+		"beta":  -100000,
+		"alpha": -1000000,
+	}
 )
 
 func (v *Version) String() string {
@@ -20,19 +53,152 @@ func (v *Version) HasArch(a string) (found bool) {
 }
 
 func (v *Version) AddArch(a string) {
-	v.Arch = append(v.Arch, a)
-	slices.Sort(v.Arch)
+	pos, _ := slices.BinarySearch(v.Arch, a)
+	v.Arch = slices.Insert(v.Arch, pos, a)
+}
+
+// AddProvides - adds modules and commands of a version file
+func (v *Version) AddProvides(p Provides) {
+	current := Provides{Modules: v.Modules, Commands: v.Commands}
+	current.Merge(p)
+	v.Modules, v.Commands = current.Modules, current.Commands
 }
 
+// Parsed - returns a parsed version name, result is cached
+func (v *Version) Parsed() *ParsedVersion {
+	if v.parsed == nil {
+		v.parsed = ParseVersion(v.Name)
+	}
+
+	return v.parsed
+}
+
+// VersionCmpFunc - orders versions by luarocks rules, versions equal by luarocks (1.0 and 1.0.0)
+// are ordered by their names
 func VersionCmpFunc(v1, v2 *Version) int {
-	s1, s2 := v1.Name, v2.Name
-	if s1 == s2 {
-		return 0
+	if c := v1.Parsed().Compare(v2.Parsed()); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(v1.Name, v2.Name)
+}
+
+// ParseVersion - parses a version string like luarocks does. Unparsable tail of a version is parsed as 0
+func ParseVersion(s string) *ParsedVersion {
+	v := strings.TrimLeftFunc(s, unicode.IsSpace)
+	pv := &ParsedVersion{String: v, Parts: make([]float64, 0, 4)}
+
+	if pos := strings.LastIndexByte(v, '-'); pos >= 0 && isDigits(v[pos+1:]) {
+		pv.Revision, _ = strconv.Atoi(v[pos+1:])
+		pv.HasRevision = true
+		v = v[:pos]
 	}
 
-	if s1 < s2 {
-		return -1
+	// i - position of a current part, words do not move it, so a number after a word is added into the same part
+	i := 0
+	set := func(value float64) {
+		if i < len(pv.Parts) {
+			pv.Parts[i] = value
+			return
+		}
+
+		pv.Parts = append(pv.Parts, value)
 	}
 
-	return 1
-}
\ No newline at end of file
+	for len(v) > 0 {
+		if n := prefixLen(v, isDigit); n > 0 {
+			number, _ := strconv.ParseFloat(v[:n], 64)
+			if i < len(pv.Parts) {
+				number = pv.Parts[i] + number/100000
+			}
+			set(number)
+			i++
+			v = trimSeparators(v[n:])
+			continue
+		}
+
+		if n := prefixLen(v, isLetter); n > 0 {
+			word := v[:n]
+			if delta, ok := versionDeltas[word]; ok {
+				set(delta)
+			} else {
+				set(float64(word[0]) / 1000)
+			}
+			v = trimSeparators(v[n:])
+			continue
+		}
+
+		// luarocks warns about such versions and stops parsing
+		set(0)
+		break
+	}
+
+	return pv
+}
+
+// Compare - compares versions, shorter version is padded by zeros.
+// Revisions are compared only when both versions have them
+func (pv *ParsedVersion) Compare(other *ParsedVersion) int {
+	for i := 0; i < max(len(pv.Parts), len(other.Parts)); i++ {
+		var a, b float64
+		if i < len(pv.Parts) {
+			a = pv.Parts[i]
+		}
+
+		if i < len(other.Parts) {
+			b = other.Parts[i]
+		}
+
+		if a != b {
+			return cmp.Compare(a, b)
+		}
+	}
+
+	if pv.HasRevision && other.HasRevision {
+		return cmp.Compare(pv.Revision, other.Revision)
+	}
+
+	return 0
+}
+
+// Equal - luarocks equality, versions must have the same number of parts
+func (pv *ParsedVersion) Equal(other *ParsedVersion) bool {
+	if !slices.Equal(pv.Parts, other.Parts) {
+		return false
+	}
+
+	if pv.HasRevision && other.HasRevision {
+		return pv.Revision == other.Revision
+	}
+
+	return true
+}
+
+// CompareVersions - compares version strings by luarocks rules
+func CompareVersions(a, b string) int {
+	return ParseVersion(a).Compare(ParseVersion(b))
+}
+
+func prefixLen(s string, fn func(c byte) bool) (n int) {
+	for n < len(s) && fn(s[n]) {
+		n++
+	}
+
+	return
+}
+
+func trimSeparators(s string) string {
+	return strings.TrimLeft(s, ".-_")
+}
+
+func isDigits(s string) bool {
+	return s != "" && prefixLen(s, isDigit) == len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,122 @@
+package luarocks
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0-1", "1.9.0-1", 1},
+		{"1.9.0-1", "1.10.0-1", -1},
+		{"1.0-1", "1.0-1", 0},
+		{"1.0-2", "1.0-1", 1},
+		{"1.0-1", "1.0-10", -1},
+		{"1.0.1-1", "1.0-2", 1},
+		{"2.3.4.5-2", "2.3.4-2", 1},
+		{"2.3.4.5-2", "2.3.4.5-1", 1},
+		{"2.3.4.5-2", "2.3.4.10-1", -1},
+		// a shorter version is padded by zeros
+		{"1.0", "1.0.0", 0},
+		{"1-1", "1.0.0-1", 0},
+		// revisions are compared only when both versions have them
+		{"1.0", "1.0-5", 0},
+		{"dev-1", "99.0-1", 1},
+		{"scm-1", "99.0-1", 1},
+		{"cvs-1", "99.0-1", 1},
+		{"dev-1", "scm-1", 1},
+		{"scm-1", "cvs-1", 1},
+		{"scm-2", "scm-1", 1},
+		{"1.0rc1-1", "1.0-1", -1},
+		{"1.0rc2-1", "1.0rc1-1", 1},
+		{"1.0beta-1", "1.0rc1-1", -1},
+		{"1.0alpha-1", "1.0beta-1", -1},
+		{"1.0pre-1", "1.0beta-1", 1},
+		{"3.0rc1-2", "2.0.2-1", 1},
+		{"0.1-1", "0.01-1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_vs_"+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in          string
+		parts       []float64
+		revision    int
+		hasRevision bool
+	}{
+		{"1.0-1", []float64{1, 0}, 1, true},
+		{"2.3.4.5-2", []float64{2, 3, 4, 5}, 2, true},
+		{"1.10.0", []float64{1, 10, 0}, 0, false},
+		{"dev-1", []float64{versionDeltas["dev"]}, 1, true},
+		{"scm-12", []float64{versionDeltas["scm"]}, 12, true},
+		{"  1.2-3", []float64{1, 2}, 3, true},
+		// a dash without a number is not a revision
+		{"1.0-beta", []float64{1, 0, versionDeltas["beta"]}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			pv := ParseVersion(tt.in)
+			if !slices.Equal(pv.Parts, tt.parts) {
+				t.Errorf("parts = %v, want %v", pv.Parts, tt.parts)
+			}
+
+			if pv.Revision != tt.revision || pv.HasRevision != tt.hasRevision {
+				t.Errorf("revision = %d, %t, want %d, %t", pv.Revision, pv.HasRevision, tt.revision, tt.hasRevision)
+			}
+		})
+	}
+}
+
+func TestParsedVersionEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.0-1", "1.0-1", true},
+		{"1.0-1", "1.0-2", false},
+		{"1.0", "1.0-2", true},
+		// luarocks equality requires the same number of parts
+		{"1.0", "1.0.0", false},
+		{"scm-1", "dev-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_eq_"+tt.b, func(t *testing.T) {
+			if got := ParseVersion(tt.a).Equal(ParseVersion(tt.b)); got != tt.want {
+				t.Errorf("Equal(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionCmpFunc(t *testing.T) {
+	names := []string{"scm-1", "1.10.0-1", "1.0-1", "dev-1", "1.9.0-1", "1.0.0-1", "1.0rc1-1", "2.3.4.5-2", "1.0-2"}
+	want := []string{"1.0rc1-1", "1.0-1", "1.0.0-1", "1.0-2", "1.9.0-1", "1.10.0-1", "2.3.4.5-2", "scm-1", "dev-1"}
+
+	versions := make([]*Version, 0, len(names))
+	for _, name := range names {
+		versions = append(versions, &Version{Name: name})
+	}
+
+	slices.SortFunc(versions, VersionCmpFunc)
+	got := make([]string, 0, len(versions))
+	for _, v := range versions {
+		got = append(got, v.Name)
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted = %v, want %v", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package luarocks
 
 import (
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -15,11 +16,12 @@ func NewWriter(w io.Writer) *Writer {
 }
 
 func (w *Writer) WriteRepositoryPackages(list RocksList) (err error) {
-	if _, err = w.Write([]byte("commands = {}\n")); err != nil {
+	modules, commands := list.Indexes()
+	if err = w.WriteIndex("commands", commands); err != nil {
 		return
 	}
 
-	if _, err = w.Write([]byte("modules = {}\n")); err != nil {
+	if err = w.WriteIndex("modules", modules); err != nil {
 		return
 	}
 
@@ -31,7 +33,7 @@ func (w *Writer) WriteRepositoryPackages(list RocksList) (err error) {
 					pErr = b.WriteVersion(version.Name, func(b *Writer) (vErr error) {
 						var arch string
 						for _, arch = range version.Arch {
-							if vErr = b.WriteVersionArch(arch); vErr != nil {
+							if vErr = b.WriteVersionItem(arch, version.Dependencies); vErr != nil {
 								return
 							}
 						}
@@ -55,6 +57,50 @@ func (w *Writer) WriteRepositoryPackages(list RocksList) (err error) {
 	})
 }
 
+// WriteIndex - writes a top level table of modules or commands: name = {["socket.http"] = {"luasocket/3.0-1"}}
+func (w *Writer) WriteIndex(name string, idx Index) (err error) {
+	if _, err = w.Write([]byte(name + " = {")); err != nil {
+		return
+	}
+
+	if len(idx) > 0 {
+		if _, err = w.Write([]byte("\n")); err != nil {
+			return
+		}
+	}
+
+	keys := make([]string, 0, len(idx))
+	for key := range idx {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if _, err = w.Write([]byte("\t[")); err != nil {
+			return
+		}
+
+		if _, err = w.WriteString(key); err != nil {
+			return
+		}
+
+		if _, err = w.Write([]byte("] = ")); err != nil {
+			return
+		}
+
+		if err = w.WriteStringList(idx[key]); err != nil {
+			return
+		}
+
+		if _, err = w.Write([]byte(",\n")); err != nil {
+			return
+		}
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return
+}
+
 func (w *Writer) WriteRepository(cb func (b *Writer) error) (err error) {
 	_, err = w.Write([]byte("repository = {"))
 	if err != nil {
@@ -111,21 +157,81 @@ func (w *Writer) WriteVersion(version string, cb func (b *Writer) error) (err er
 }
 
 func (w *Writer) WriteVersionArch(arch string) (err error){
-	if _, err = w.Write([]byte("\t\t\t{arch = \"")); err != nil {
+	return w.WriteVersionItem(arch, nil)
+}
+
+// WriteVersionItem - writes a version item, like {arch = "rockspec", dependencies = {"lua >= 5.1"}}
+func (w *Writer) WriteVersionItem(arch string, dependencies []string) (err error) {
+	if _, err = w.Write([]byte("\t\t\t{arch = ")); err != nil {
 		return
 	}
 
-	if _, err = w.Write([]byte(arch)); err != nil {
+	if _, err = w.WriteString(arch); err != nil {
+		return
+	}
+
+	if len(dependencies) > 0 {
+		if _, err = w.Write([]byte(", dependencies = ")); err != nil {
+			return
+		}
+
+		if err = w.WriteStringList(dependencies); err != nil {
+			return
+		}
+	}
+
+	if _, err = w.Write([]byte("},\n")); err != nil {
 		return
 	}
 
-	if _, err = w.Write([]byte("\"},\n")); err != nil {
+	return
+}
+
+// WriteStringList - writes an array of strings in a single line: {"a", "b"}
+func (w *Writer) WriteStringList(list []string) (err error) {
+	if _, err = w.Write([]byte("{")); err != nil {
 		return
 	}
 
+	for i, s := range list {
+		if i > 0 {
+			if _, err = w.Write([]byte(", ")); err != nil {
+				return
+			}
+		}
+
+		if _, err = w.WriteString(s); err != nil {
+			return
+		}
+	}
+
+	_, err = w.Write([]byte("}"))
 	return
 }
 
+// WriteString - writes a double-quoted lua string, special and non-printable chars are escaped
+func (w *Writer) WriteString(s string) (int, error) {
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c == '\n':
+			b = append(b, '\\', 'n')
+		case c < ' ' || c == 0x7f:
+			// always 3 digits, so a next digit char is not a part of an escape
+			b = append(b, '\\', '0'+c/100, '0'+c/10%10, '0'+c%10)
+		default:
+			b = append(b, c)
+		}
+	}
+	b = append(b, '"')
+
+	return w.Write(b)
+}
+
 func (w *Writer) WriteMultilineString(s string) (n int, err error) {
 	var (
 		part string
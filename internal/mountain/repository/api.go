@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"lua-mountain/internal/mountain/luarocks"
+	"lua-mountain/internal/mountain/server/mw"
+)
+
+const (
+	// UploadToolVersion - version of luarocks upload client, reported by /api/tool_version
+	UploadToolVersion = "1.0.0"
+	UploadAPIVersion  = "1"
+
+	redactedKey = "******"
+)
+
+type (
+	// UploadAPI - luarocks.org compatible upload api (luarocks upload --server --api-key).
+	// An api key selects a repository, files are stored by Repository.store, like PUT requests
+	UploadAPI struct {
+		keys   map[string]*Repository
+		logger *slog.Logger
+	}
+
+	apiModule struct {
+		Name string `json:"name"`
+	}
+
+	apiVersion struct {
+		ID      uint32 `json:"id"`
+		Version string `json:"version"`
+	}
+
+	apiResponse struct {
+		Module    *apiModule  `json:"module,omitempty"`
+		Version   *apiVersion `json:"version,omitempty"`
+		IsNew     bool        `json:"is_new,omitempty"`
+		ModuleURL string      `json:"module_url,omitempty"`
+		Manifests []string    `json:"manifests,omitempty"`
+	}
+)
+
+// NewUploadAPI - collects api keys of repositories, a key must belong to a single repository
+func NewUploadAPI(repos []*Repository, logger *slog.Logger) (*UploadAPI, error) {
+	api := &UploadAPI{
+		keys:   make(map[string]*Repository, len(repos)),
+		logger: logger,
+	}
+
+	for _, repo := range repos {
+		for _, key := range repo.ApiKeys {
+			if key == "" {
+				return nil, fmt.Errorf("repository %s: empty api key", repo.Prefix)
+			}
+
+			if other, ok := api.keys[key]; ok {
+				return nil, fmt.Errorf("repository %s: api key is already used by %s", repo.Prefix, other.Prefix)
+			}
+
+			api.keys[key] = repo
+		}
+	}
+
+	return api, nil
+}
+
+// Enabled - api is served only when some repository has keys
+func (api *UploadAPI) Enabled() bool {
+	return len(api.keys) > 0
+}
+
+// ToolVersion - luarocks checks its upload client version before any call
+func (api *UploadAPI) ToolVersion(eCtx echo.Context) error {
+	return eCtx.JSON(http.StatusOK, map[string]string{"version": UploadToolVersion})
+}
+
+// Status - checks an api key
+func (api *UploadAPI) Status(eCtx echo.Context) error {
+	repo, err := api.repository(eCtx)
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	return eCtx.JSON(http.StatusOK, map[string]string{"repository": repo.Prefix})
+}
+
+// CheckRockspec - reports, whether a package and its version already exist
+func (api *UploadAPI) CheckRockspec(eCtx echo.Context) error {
+	repo, err := api.repository(eCtx)
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	var (
+		ctx     = api.context(eCtx)
+		pkg     = strings.ToLower(eCtx.QueryParam("package"))
+		version = eCtx.QueryParam("version")
+		resp    apiResponse
+	)
+
+	if pkg == "" || version == "" {
+		return apiError(eCtx, errors.New("package and version are required"))
+	}
+
+	list, err := repo.rocksList(ctx, "")
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	if rock := list.Search(pkg); rock != nil {
+		resp.Module = &apiModule{Name: rock.Name}
+		if v := rock.SearchVersion(version); v != nil {
+			resp.Version = newAPIVersion(rock.Name, v.Name)
+		}
+	}
+
+	return eCtx.JSON(http.StatusOK, resp)
+}
+
+// Upload - stores a rockspec from rockspec_file form field, a filename is built by a rockspec package and version
+func (api *UploadAPI) Upload(eCtx echo.Context) error {
+	repo, err := api.repository(eCtx)
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	ctx := api.context(eCtx)
+	content, err := readFormFile(eCtx, "rockspec_file", min(repo.MaxFileSize, luarocks.MaxRockspecSize))
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	spec, err := luarocks.ParseRockspec(ctx, bytes.NewReader(content))
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	name := strings.ToLower(spec.Package)
+	list, err := repo.rocksList(ctx, "")
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	filename := name + "-" + spec.Version + ".rockspec"
+	if err = mw.CheckExtension(filename, repo.AllowedFileExtensions); err != nil {
+		return apiError(eCtx, err)
+	}
+
+	if err = repo.store(ctx, filename, bytes.NewReader(content), false); err != nil {
+		return apiError(eCtx, err)
+	}
+
+	api.logger.InfoContext(ctx, "rockspec uploaded by api",
+		slog.String("repository", repo.Prefix),
+		slog.String("filename", filename),
+	)
+
+	return eCtx.JSON(http.StatusOK, apiResponse{
+		Module:    &apiModule{Name: name},
+		Version:   newAPIVersion(name, spec.Version),
+		IsNew:     list.Search(name) == nil,
+		ModuleURL: moduleURL(eCtx, repo, filename),
+		Manifests: []string{repo.Prefix},
+	})
+}
+
+// UploadRock - stores a rock from rock_file form field, the rock must belong to a version from an upload response
+func (api *UploadAPI) UploadRock(eCtx echo.Context) error {
+	repo, err := api.repository(eCtx)
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+
+	id, err := strconv.ParseUint(eCtx.Param("id"), 10, 32)
+	if err != nil {
+		return apiError(eCtx, errors.New("invalid version id"))
+	}
+
+	f, header, err := formFile(eCtx, "rock_file", repo.MaxFileSize)
+	if err != nil {
+		return apiError(eCtx, err)
+	}
+	defer f.Close()
+
+	filename := path.Base(header.Filename)
+	name, version, arch, err := luarocks.ParseFilename(filename)
+	if err != nil || arch == "rockspec" {
+		return apiError(eCtx, fmt.Errorf("%s is not a rock filename", filename))
+	}
+
+	if newAPIVersion(name, version).ID != uint32(id) {
+		return apiError(eCtx, fmt.Errorf("%s does not belong to version %d", filename, id))
+	}
+
+	if err = mw.CheckExtension(filename, repo.AllowedFileExtensions); err != nil {
+		return apiError(eCtx, err)
+	}
+
+	ctx := api.context(eCtx)
+	if err = repo.store(ctx, filename, f, false); err != nil {
+		return apiError(eCtx, err)
+	}
+
+	api.logger.InfoContext(ctx, "rock uploaded by api",
+		slog.String("repository", repo.Prefix),
+		slog.String("filename", filename),
+	)
+
+	return eCtx.JSON(http.StatusOK, apiResponse{
+		Module:    &apiModule{Name: name},
+		Version:   newAPIVersion(name, version),
+		ModuleURL: moduleURL(eCtx, repo, filename),
+	})
+}
+
+// RedactAPIKey - hides an api key of upload api paths like /api/1/<key>/upload, other paths are returned as is
+func RedactAPIKey(p string) string {
+	prefix := "/api/" + UploadAPIVersion + "/"
+	rest, ok := strings.CutPrefix(p, prefix)
+	if !ok || rest == "" {
+		return p
+	}
+
+	if _, tail, found := strings.Cut(rest, "/"); found {
+		return prefix + redactedKey + "/" + tail
+	}
+
+	return prefix + redactedKey
+}
+
+func (api *UploadAPI) repository(eCtx echo.Context) (*Repository, error) {
+	repo, ok := api.keys[eCtx.Param("key")]
+	if !ok {
+		// luarocks client recognizes this message and suggests --api-key flag
+		return nil, errors.New("Invalid key")
+	}
+
+	return repo, nil
+}
+
+func (api *UploadAPI) context(eCtx echo.Context) context.Context {
+	requestID := eCtx.Request().Header.Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = eCtx.Response().Header().Get(echo.HeaderXRequestID)
+	}
+
+	return context.WithValue(eCtx.Request().Context(), RequestIdContextKey, requestID)
+}
+
+// apiError - luarocks client expects errors as {"errors": [...]} with 200 status, other statuses are reported
+// without a message
+func apiError(eCtx echo.Context, err error) error {
+	msg := err.Error()
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		msg = fmt.Sprint(httpErr.Message)
+	}
+
+	return eCtx.JSON(http.StatusOK, map[string][]string{"errors": {msg}})
+}
+
+// newAPIVersion - luarocks uses a version id only to upload rocks after a rockspec, so a checksum
+// of a name and a version is enough
+func newAPIVersion(name, version string) *apiVersion {
+	return &apiVersion{
+		ID:      crc32.ChecksumIEEE([]byte(name + "-" + version)),
+		Version: version,
+	}
+}
+
+func moduleURL(eCtx echo.Context, repo *Repository, filename string) string {
+	return eCtx.Scheme() + "://" + eCtx.Request().Host + path.Join("/", repo.Prefix, filename)
+}
+
+func formFile(eCtx echo.Context, field string, maxSize uint64) (multipart.File, *multipart.FileHeader, error) {
+	header, err := eCtx.FormFile(field)
+	if err != nil {
+		return nil, nil, fmt.Errorf("form file %s: %w", field, err)
+	}
+
+	if header.Size <= 0 {
+		return nil, nil, fmt.Errorf("form file %s is empty", field)
+	}
+
+	if uint64(header.Size) > maxSize {
+		return nil, nil, fmt.Errorf("max allowed file size %d, got %d", maxSize, header.Size)
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("form file %s: %w", field, err)
+	}
+
+	return f, header, nil
+}
+
+func readFormFile(eCtx echo.Context, field string, maxSize uint64) ([]byte, error) {
+	f, _, err := formFile(eCtx, field, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"lua-mountain/internal/mountain/luarocks"
+)
+
+const (
+	// searchIndexKey - a singleflight key of index builds, it does not clash with manifest names
+	searchIndexKey = "/search-index"
+
+	// manifestBuildTimeout - a limit of a shared build, it is not cancelled by a request, which started it
+	manifestBuildTimeout = time.Minute * 2
+
+	defaultManifestCacheTTL     = time.Minute
+	defaultManifestCacheControl = "no-cache"
+)
+
+type (
+	ManifestCacheConfig struct {
+		// TTL - lifetime of a manifest snapshot, changes made out of mountain (manual files, nexus ui)
+		// are visible after it. Uploads and deletes via mountain invalidate snapshots immediately
+		TTL          time.Duration `yaml:"ttl"`
+		CacheControl string        `yaml:"cache_control"`
+	}
+
+	// manifestCache - rendered manifests by request name (manifest-5.1, manifest-5.1.json, ...)
+	manifestCache struct {
+		mut          sync.Mutex
+		group        singleflight.Group
+		ttl          time.Duration
+		cacheControl string
+		generation   uint64
+		snapshots    map[string]*manifestSnapshot
+		index        *searchIndex
+	}
+
+	manifestSnapshot struct {
+		body     []byte
+		etag     string
+		modified time.Time
+		built    time.Time
+	}
+
+	// searchIndex - modules and commands of a full manifest, it's shared by searches of a same generation
+	searchIndex struct {
+		modules  luarocks.Index
+		commands luarocks.Index
+		built    time.Time
+	}
+)
+
+func newManifestCache(cfg ManifestCacheConfig) *manifestCache {
+	mc := &manifestCache{
+		ttl:          cfg.TTL,
+		cacheControl: cfg.CacheControl,
+		snapshots:    make(map[string]*manifestSnapshot, 15),
+	}
+
+	if mc.ttl == 0 {
+		mc.ttl = defaultManifestCacheTTL
+	}
+
+	if mc.cacheControl == "" {
+		mc.cacheControl = defaultManifestCacheControl
+	}
+
+	return mc
+}
+
+// Get - returns a fresh snapshot or builds a new one. Concurrent builds of a same manifest are executed once.
+// When a rebuilt manifest has the same content, ETag and Last-Modified of a previous snapshot are kept
+func (mc *manifestCache) Get(
+	ctx context.Context,
+	key string,
+	build func(ctx context.Context) ([]byte, error),
+) (*manifestSnapshot, error) {
+	mc.mut.Lock()
+	snap := mc.snapshots[key]
+	generation := mc.generation
+	mc.mut.Unlock()
+
+	if snap != nil && time.Since(snap.built) < mc.ttl {
+		return snap, nil
+	}
+
+	v, err := shared(ctx, &mc.group, key, manifestBuildTimeout, func(ctx context.Context) (any, error) {
+		body, err := build(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		sum := sha256.Sum256(body)
+		fresh := &manifestSnapshot{
+			body:     body,
+			etag:     `"` + hex.EncodeToString(sum[:16]) + `"`,
+			modified: now,
+			built:    now,
+		}
+
+		if snap != nil && bytes.Equal(snap.body, body) {
+			fresh.etag = snap.etag
+			fresh.modified = snap.modified
+		}
+
+		mc.mut.Lock()
+		// a repository was changed during a build, so the snapshot may be outdated already
+		if generation == mc.generation {
+			mc.snapshots[key] = fresh
+		}
+		mc.mut.Unlock()
+
+		return fresh, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*manifestSnapshot), nil
+}
+
+// Index - returns a fresh search index or builds a new one, like Get does for manifests
+func (mc *manifestCache) Index(
+	ctx context.Context,
+	build func(ctx context.Context) (luarocks.RocksList, error),
+) (*searchIndex, error) {
+	mc.mut.Lock()
+	idx := mc.index
+	generation := mc.generation
+	mc.mut.Unlock()
+
+	if idx != nil && time.Since(idx.built) < mc.ttl {
+		return idx, nil
+	}
+
+	v, err := shared(ctx, &mc.group, searchIndexKey, manifestBuildTimeout, func(ctx context.Context) (any, error) {
+		list, err := build(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh := &searchIndex{built: time.Now()}
+		fresh.modules, fresh.commands = list.Indexes()
+
+		mc.mut.Lock()
+		if generation == mc.generation {
+			mc.index = fresh
+		}
+		mc.mut.Unlock()
+
+		return fresh, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*searchIndex), nil
+}
+
+// shared - executes fn once for concurrent callers of a key. A caller, which leaves, does not cancel fn:
+// it gets a detached ctx with a timeout, callers stop waiting, when their own ctx is done
+func shared(
+	ctx context.Context,
+	group *singleflight.Group,
+	key string,
+	timeout time.Duration,
+	fn func(ctx context.Context) (any, error),
+) (any, error) {
+	ch := group.DoChan(key, func() (any, error) {
+		sCtx, done := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer done()
+
+		return fn(sCtx)
+	})
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate - drops all snapshots and a search index
+func (mc *manifestCache) Invalidate() {
+	mc.mut.Lock()
+	defer mc.mut.Unlock()
+
+	mc.generation++
+	clear(mc.snapshots)
+	mc.index = nil
+}
+
+// invalidate - drops manifest snapshots of a repository and of all groups, which include it
+func (r *Repository) invalidate(filename string) {
+	if r.specs != nil {
+		r.specs.Invalidate(filename)
+		r.rocks.Invalidate(filename)
+	}
+
+	r.manifests.Invalidate()
+
+	r.groupsMut.RLock()
+	groups := r.groups
+	r.groupsMut.RUnlock()
+
+	for _, group := range groups {
+		group.invalidate(filename)
+	}
+}
+
+func (r *Repository) addGroup(group *Repository) {
+	r.groupsMut.Lock()
+	defer r.groupsMut.Unlock()
+
+	r.groups = append(r.groups, group)
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestManifestCacheLeavingCaller - a caller, which starts a shared build and leaves, does not fail other callers
+func TestManifestCacheLeavingCaller(t *testing.T) {
+	mc := newManifestCache(ManifestCacheConfig{})
+	started, release := make(chan struct{}), make(chan struct{})
+	build := func(ctx context.Context) ([]byte, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		return []byte("manifest"), nil
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := mc.Get(first, "manifest", build)
+		firstErr <- err
+	}()
+
+	<-started
+	second := make(chan *manifestSnapshot, 1)
+	secondErr := make(chan error, 1)
+	go func() {
+		snap, err := mc.Get(context.Background(), "manifest", func(context.Context) ([]byte, error) {
+			return nil, errors.New("a second build is not expected")
+		})
+		second <- snap
+		secondErr <- err
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first caller: got %v, want context.Canceled", err)
+	}
+
+	// the second caller joins the build, which is still running
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+
+	if err := <-secondErr; err != nil {
+		t.Fatalf("second caller: unexpected err: %v", err)
+	}
+
+	if snap := <-second; string(snap.body) != "manifest" {
+		t.Errorf("second caller: got %q, want manifest", snap.body)
+	}
+
+	// a built snapshot is cached
+	snap, err := mc.Get(context.Background(), "manifest", func(context.Context) ([]byte, error) {
+		return nil, errors.New("a cached snapshot is expected")
+	})
+	if err != nil || string(snap.body) != "manifest" {
+		t.Errorf("cached: got %v, %v", snap, err)
+	}
+}
+
+func TestManifestCacheInvalidate(t *testing.T) {
+	mc := newManifestCache(ManifestCacheConfig{TTL: time.Hour})
+	builds := 0
+	build := func(context.Context) ([]byte, error) {
+		builds++
+		return []byte("manifest"), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := mc.Get(context.Background(), "manifest", build); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	mc.Invalidate()
+	snap, err := mc.Get(context.Background(), "manifest", build)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if builds != 2 {
+		t.Errorf("got %d builds, want 2", builds)
+	}
+
+	if snap.etag == "" {
+		t.Error("etag is empty")
+	}
+}
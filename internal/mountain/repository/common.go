@@ -1,8 +1,15 @@
 package repository
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"lua-mountain/internal/mountain/auth"
+	"lua-mountain/internal/mountain/luarocks"
 	"lua-mountain/internal/mountain/storage"
+	"lua-mountain/pkg/slogan"
+	pstorage "lua-mountain/pkg/storage"
+	"sync"
 )
 
 const (
@@ -16,6 +23,22 @@ type (
 		AllowedFileExtensions []string `yaml:"allowed_file_extensions"`
 		AllowRewrite          bool     `yaml:"allow_rewrite"`
 		MaxFileSize           uint64   `yaml:"max_file_size"`
+		// Upstream - makes a repository a pull-through proxy of another rocks server
+		Upstream *UpstreamConfig `yaml:"upstream"`
+		// Members - prefixes of other repositories, makes a repository a virtual group.
+		// Files are resolved by members order
+		Members []string `yaml:"members"`
+		// LuaVersions - versioned manifests, DefaultLuaVersions are used when empty
+		LuaVersions []LuaVersion `yaml:"lua_versions"`
+		// ManifestCache - lifetime of manifest snapshots and Cache-Control header of manifest responses
+		ManifestCache ManifestCacheConfig `yaml:"manifest_cache"`
+		// ApiKeys - keys of luarocks upload api (luarocks upload --api-key), a key gives write access to a repository
+		ApiKeys []string `yaml:"api_keys"`
+		// AnonymousRead - allows reading without credentials, when authentication is enabled.
+		// Default is true, repositories with htpasswd users are private by default
+		AnonymousRead *bool `yaml:"anonymous_read"`
+		// Htpasswd - basic auth users of a repository
+		Htpasswd *auth.HtpasswdConfig `yaml:"htpasswd"`
 	}
 
 	Repository struct {
@@ -25,16 +48,35 @@ type (
 		AllowedFileExtensions []string
 		AllowRewrite          bool
 		MaxFileSize           uint64
+		Upstream              *Upstream
+		Members               []*Repository
+		LuaVersions           []LuaVersion
+		ApiKeys               []string
+		AnonymousRead         bool
+		specs                 *fileCache[*luarocks.Rockspec]
+		rocks                 *fileCache[*luarocks.Provides]
+		manifests             *manifestCache
+		// groupsMut - guards groups, they are invalidated by storage callbacks
+		groupsMut sync.RWMutex
+		groups    []*Repository
 	}
 )
 
-func New(cfg *Config, storage storage.Storage, logger *slog.Logger) *Repository {
+// New - creates a repository of a storage, storage callbacks of a repository are removed, when ctx is done
+func New(ctx context.Context, cfg *Config, storage storage.Storage, logger *slog.Logger) (*Repository, error) {
 
 	repo := &Repository{
+		Prefix:                cfg.Prefix,
 		Storage:               storage,
 		AllowRewrite:          cfg.AllowRewrite,
 		MaxFileSize:           cfg.MaxFileSize,
 		AllowedFileExtensions: cfg.AllowedFileExtensions,
+		LuaVersions:           cfg.LuaVersions,
+		ApiKeys:               cfg.ApiKeys,
+		AnonymousRead:         cfg.anonymousRead(),
+		specs:                 newFileCache[*luarocks.Rockspec](),
+		rocks:                 newFileCache[*luarocks.Provides](),
+		manifests:             newManifestCache(cfg.ManifestCache),
 		logger: logger.With(
 			slog.String("prefix", cfg.Prefix),
 		),
@@ -48,11 +90,38 @@ func New(cfg *Config, storage storage.Storage, logger *slog.Logger) *Repository
 		repo.AllowedFileExtensions = []string{".rockspec", "rock"}
 	}
 
+	if repo.LuaVersions == nil {
+		repo.LuaVersions = DefaultLuaVersions
+	}
+
+	if cfg.Upstream != nil {
+		var err error
+		if repo.Upstream, err = NewUpstream(cfg.Upstream, repo.logger); err != nil {
+			return nil, fmt.Errorf("repository %s: %w", cfg.Prefix, err)
+		}
+
+		repo.logger.Info("repo is a proxy", slogan.SanitizedURL("upstream", repo.Upstream.Url))
+	}
+
+	// files, which are replaced or removed out of mountain, must not keep their metadata
+	if notifier, ok := storage.(pstorage.Notifier); ok {
+		notifier.OnChange(ctx, repo.invalidate)
+	}
+
 	repo.logger.Info("repo created",
 		slog.Bool("rewrite", repo.AllowRewrite),
 		slog.Uint64("max_file_size", repo.MaxFileSize),
 		slog.Any("allowed_file_extensions", repo.AllowedFileExtensions),
+		slog.Any("manifests", repo.ManifestNames()),
 	)
 
-	return repo
+	return repo, nil
+}
+
+func (cfg *Config) anonymousRead() bool {
+	if cfg.AnonymousRead == nil {
+		return cfg.Htpasswd == nil
+	}
+
+	return *cfg.AnonymousRead
 }
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"testing"
+
+	"lua-mountain/internal/mountain/auth"
+)
+
+func TestConfigAnonymousRead(t *testing.T) {
+	yes, no := true, false
+	htpasswd := &auth.HtpasswdConfig{File: "htpasswd", ReadUsers: []string{"bob"}}
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"default", Config{}, true},
+		{"htpasswd is private by default", Config{Htpasswd: htpasswd}, false},
+		{"explicit true", Config{AnonymousRead: &yes}, true},
+		{"explicit false", Config{AnonymousRead: &no}, false},
+		{"explicit true with htpasswd", Config{AnonymousRead: &yes, Htpasswd: htpasswd}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.anonymousRead(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/labstack/echo/v4"
 	"log/slog"
 	"net/http"
@@ -22,7 +23,8 @@ func (r *Repository) Delete(eCtx echo.Context) error {
 	filename := eCtx.Param("filename")
 	ctx := context.WithValue(req.Context(), RequestIdContextKey, requestID)
 
-	if err := r.Storage.Delete(ctx, filename); err != nil && !os.IsNotExist(err) {
+	defer r.invalidate(filename)
+	if err := r.Storage.Delete(ctx, filename); err != nil && !errors.Is(err, os.ErrNotExist) {
 		r.logger.ErrorContext(ctx, "storage.Delete() err",
 			slog.String("err", err.Error()),
 			slog.String("filename", filename),
@@ -2,10 +2,17 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+)
+
+var (
+	errUpstream = errors.New("upstream err")
 )
 
 func (r *Repository) Get(eCtx echo.Context) error {
@@ -17,12 +24,49 @@ func (r *Repository) Get(eCtx echo.Context) error {
 	ctx := context.WithValue(eCtx.Request().Context(), RequestIdContextKey, requestID)
 
 	filename := eCtx.Param("filename")
-	if err := r.Storage.Exists(ctx, filename); err != nil {
-		r.logger.ErrorContext(ctx, "storage.Exists() call err",
-			slog.String("err", err.Error()),
-			slog.String("filename", filename),
-		)
+	f, err := r.open(ctx, filename)
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist):
 		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("file %s not found", filename))
+	case errors.Is(err, errUpstream):
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("unable to fetch %s from upstream", filename))
+	default:
+		return err
+	}
+
+	defer f.Close()
+
+	return eCtx.Stream(http.StatusOK, echo.MIMETextPlain, f)
+}
+
+// open - opens a file in a storage. Missing files of proxy repositories are pulled from upstream,
+// groups search a file in members
+func (r *Repository) open(ctx context.Context, filename string) (io.ReadCloser, error) {
+	if r.IsGroup() {
+		return r.openFromMembers(ctx, filename)
+	}
+
+	if err := r.Storage.Exists(ctx, filename); err != nil {
+		if r.Upstream == nil {
+			r.logger.ErrorContext(ctx, "storage.Exists() call err",
+				slog.String("err", err.Error()),
+				slog.String("filename", filename),
+			)
+			return nil, fmt.Errorf("%w: %w", err, os.ErrNotExist)
+		}
+
+		if err = r.Upstream.Pull(ctx, filename, r.Storage); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+
+			r.logger.ErrorContext(ctx, "upstream.Pull() call err",
+				slog.String("err", err.Error()),
+				slog.String("filename", filename),
+			)
+			return nil, fmt.Errorf("%w: %w", errUpstream, err)
+		}
 	}
 
 	f, err := r.Storage.Get(ctx, filename)
@@ -31,10 +75,8 @@ func (r *Repository) Get(eCtx echo.Context) error {
 			slog.String("err", err.Error()),
 			slog.String("filename", filename),
 		)
-		return err
+		return nil, err
 	}
 
-	defer f.Close()
-
-	return eCtx.Stream(http.StatusOK, echo.MIMETextPlain, f)
-}
\ No newline at end of file
+	return f, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"lua-mountain/internal/mountain/luarocks"
+)
+
+// NewGroup - creates a virtual repository, which aggregates members.
+// Members order defines a precedence, when a file exists in several members, the first one is used.
+// A group is read anonymously only when all members are, anonymous_read: true over a private member is an error
+func NewGroup(cfg *Config, members []*Repository, logger *slog.Logger) (*Repository, error) {
+	if cfg.Storage != "" || cfg.Upstream != nil {
+		return nil, fmt.Errorf("repository %s: group can not have a storage or an upstream", cfg.Prefix)
+	}
+
+	if len(members) == 0 {
+		return nil, fmt.Errorf("repository %s: group must have members", cfg.Prefix)
+	}
+
+	anonymousRead := cfg.anonymousRead()
+	for _, member := range members {
+		if member.AnonymousRead {
+			continue
+		}
+
+		if cfg.AnonymousRead != nil && *cfg.AnonymousRead {
+			return nil, fmt.Errorf("repository %s: anonymous_read is set, but member %s is private",
+				cfg.Prefix, member.Prefix)
+		}
+
+		anonymousRead = false
+	}
+
+	repo := &Repository{
+		Prefix:                cfg.Prefix,
+		Members:               members,
+		AllowedFileExtensions: cfg.AllowedFileExtensions,
+		LuaVersions:           cfg.LuaVersions,
+		AnonymousRead:         anonymousRead,
+		manifests:             newManifestCache(cfg.ManifestCache),
+		logger: logger.With(
+			slog.String("prefix", cfg.Prefix),
+		),
+	}
+
+	if repo.AllowedFileExtensions == nil {
+		repo.AllowedFileExtensions = []string{".rockspec", "rock"}
+	}
+
+	if repo.LuaVersions == nil {
+		repo.LuaVersions = DefaultLuaVersions
+	}
+
+	prefixes := make([]string, 0, len(members))
+	for _, member := range members {
+		prefixes = append(prefixes, member.Prefix)
+		// changes of a member invalidate group manifests
+		member.addGroup(repo)
+	}
+
+	repo.logger.Info("group repo created",
+		slog.Any("members", prefixes),
+		slog.Bool("anonymous_read", repo.AnonymousRead),
+		slog.Any("allowed_file_extensions", repo.AllowedFileExtensions),
+		slog.Any("manifests", repo.ManifestNames()),
+	)
+
+	return repo, nil
+}
+
+// IsGroup - virtual repositories have no own storage and only aggregates members
+func (r *Repository) IsGroup() bool {
+	return len(r.Members) > 0
+}
+
+// ReadScope - prefixes, which a principal must be allowed to read, to read a repository.
+// Files of members are served by a group, so members of a group and of nested groups are included
+func (r *Repository) ReadScope() []string {
+	scope := []string{r.Prefix}
+	for _, member := range r.Members {
+		for _, prefix := range member.ReadScope() {
+			if !slices.Contains(scope, prefix) {
+				scope = append(scope, prefix)
+			}
+		}
+	}
+
+	return scope
+}
+
+// openFromMembers - searches a file in members by their precedence
+func (r *Repository) openFromMembers(ctx context.Context, filename string) (io.ReadCloser, error) {
+	var lastErr error
+	for _, member := range r.Members {
+		f, err := member.open(ctx, filename)
+		if err == nil {
+			r.logger.DebugContext(ctx, "file resolved by member",
+				slog.String("filename", filename),
+				slog.String("member", member.Prefix),
+			)
+			return f, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			r.logger.WarnContext(ctx, "member open err",
+				slog.String("filename", filename),
+				slog.String("member", member.Prefix),
+				slog.String("err", err.Error()),
+			)
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, fmt.Errorf("%s not found in group members: %w", filename, os.ErrNotExist)
+}
+
+// rocksListFromMembers - merges members manifests, unavailable members are skipped
+func (r *Repository) rocksListFromMembers(ctx context.Context, luaVersion string) (luarocks.RocksList, error) {
+	list := make(luarocks.RocksList, 0, 10)
+	for _, member := range r.Members {
+		mList, err := member.rocksList(ctx, luaVersion)
+		if err != nil {
+			r.logger.WarnContext(ctx, "member manifest is unavailable, skipped",
+				slog.String("member", member.Prefix),
+				slog.String("lua", luaVersion),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		list.Merge(mList)
+	}
+
+	return list, nil
+}
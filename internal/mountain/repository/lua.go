@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// LuaVersion - versioned manifest, served as manifest-<Name> and filtered by a rockspec lua dependency.
+	// In config, it can be set as a scalar "5.4" or as a mapping {name: luajit, lua: "5.1"}
+	LuaVersion struct {
+		Name string `yaml:"name"`
+		Lua  string `yaml:"lua"`
+	}
+)
+
+var (
+	DefaultLuaVersions = []LuaVersion{
+		{Name: "5.1", Lua: "5.1"},
+		{Name: "5.2", Lua: "5.2"},
+		{Name: "5.3", Lua: "5.3"},
+		{Name: "5.4", Lua: "5.4"},
+	}
+)
+
+func (lv *LuaVersion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		lv.Name = node.Value
+		lv.Lua = node.Value
+		return nil
+	}
+
+	type plain LuaVersion
+	if err := node.Decode((*plain)(lv)); err != nil {
+		return err
+	}
+
+	if lv.Name == "" {
+		return errors.New("lua version name is required")
+	}
+
+	if lv.Lua == "" {
+		lv.Lua = lv.Name
+	}
+
+	return nil
+}
+
+// ManifestNames - all manifest names, served by a repository
+func (r *Repository) ManifestNames() []string {
+	names := make([]string, 0, len(r.LuaVersions)+1)
+	names = append(names, "manifest")
+	for _, lv := range r.LuaVersions {
+		names = append(names, "manifest-"+lv.Name)
+	}
+
+	return names
+}
+
+// luaVersion - returns a lua version of a manifest by its name, empty string means an unfiltered manifest
+func (r *Repository) luaVersion(manifest string) string {
+	for _, lv := range r.LuaVersions {
+		if manifest == "manifest-"+lv.Name {
+			return lv.Lua
+		}
+	}
+
+	return ""
+}
@@ -2,27 +2,54 @@ package repository
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"io"
 	"log/slog"
 	"lua-mountain/internal/mountain/luarocks"
 	"net/http"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
+func (r *Repository) GetManifest(eCtx echo.Context) error {
+	return r.serveManifest(eCtx, "text/x-lua", func(w io.Writer, _ string, list luarocks.RocksList) error {
+		return luarocks.NewWriter(w).WriteRepositoryPackages(list)
+	})
+}
 
-var (
-	semverRegexp = regexp.MustCompile(
-	"(0|[1-9]\\d*)\\.(0|[1-9]\\d*)\\.(0|[1-9]\\d*)(?:-((?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*)" +
-		"(?:\\.(?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\\+([0-9a-zA-Z-]+(?:\\.[0-9a-zA-Z-]+)*))?$",
-	 )
-)
+func (r *Repository) GetManifestJson(eCtx echo.Context) error {
+	return r.serveManifest(eCtx, echo.MIMEApplicationJSON, func(w io.Writer, _ string, list luarocks.RocksList) error {
+		return json.NewEncoder(w).Encode(list)
+	})
+}
 
+func (r *Repository) GetManifestZip(eCtx echo.Context) error {
+	return r.serveManifest(eCtx, "application/zip", func(w io.Writer, filename string, list luarocks.RocksList) error {
+		archive := zip.NewWriter(w)
+		f, err := archive.Create(filename)
+		if err != nil {
+			return fmt.Errorf("unable to create archive: %w", err)
+		}
 
-func (r *Repository) GetManifest(eCtx echo.Context) error {
+		if err = luarocks.NewWriter(f).WriteRepositoryPackages(list); err != nil {
+			return err
+		}
+
+		return archive.Close()
+	})
+}
+
+// serveManifest - serves a cached manifest snapshot with ETag and Last-Modified headers,
+// conditional requests are answered with 304
+func (r *Repository) serveManifest(
+	eCtx echo.Context,
+	contentType string,
+	render func(w io.Writer, name string, list luarocks.RocksList) error,
+) error {
 	req := eCtx.Request()
 	resp := eCtx.Response()
 	requestID := req.Header.Get(echo.HeaderXRequestID)
@@ -31,116 +58,111 @@ func (r *Repository) GetManifest(eCtx echo.Context) error {
 	}
 
 	ctx := context.WithValue(req.Context(), RequestIdContextKey, requestID)
+	name := manifestName(req.URL.Path)
+	snap, err := r.manifests.Get(ctx, filepath.Base(req.URL.Path), func(ctx context.Context) ([]byte, error) {
+		list, err := r.rocksList(ctx, r.luaVersion(name))
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err = render(&buf, name, list); err != nil {
+			r.logger.ErrorContext(ctx, "manifest render err",
+				slog.String("err", err.Error()),
+				slog.String("manifest", name),
+			)
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	})
 
-	list, err := r.Storage.List(ctx)
 	if err != nil {
-		r.logger.ErrorContext(ctx, "storage.List() err", slog.String("err", err.Error()))
 		return err
 	}
 
-	resp.Header().Add("Content-Type", "text/x-lua")
-	writer := luarocks.NewWriter(resp)
-	if err = writer.WriteRepositoryPackages(r.getRocksList(ctx, list)); err != nil {
-		return err
-	}
+	resp.Header().Set(echo.HeaderContentType, contentType)
+	resp.Header().Set("ETag", snap.etag)
+	resp.Header().Set("Cache-Control", r.manifests.cacheControl)
+	http.ServeContent(resp, req, "", snap.modified, bytes.NewReader(snap.body))
 
 	return nil
 }
 
-func (r *Repository) GetManifestJson(eCtx echo.Context) error {
-	req := eCtx.Request()
-	resp := eCtx.Response()
-	requestID := req.Header.Get(echo.HeaderXRequestID)
-	if requestID == "" {
-		requestID = resp.Header().Get(echo.HeaderXRequestID)
+// rocksList - builds a list of rocks for a manifest. Non-empty luaVersion filters rocks by their lua dependency.
+// Proxy repositories merge an upstream manifest into local one, local files have a priority.
+// Groups merge manifests of all members
+func (r *Repository) rocksList(ctx context.Context, luaVersion string) (luarocks.RocksList, error) {
+	if r.IsGroup() {
+		return r.rocksListFromMembers(ctx, luaVersion)
 	}
 
-	ctx := context.WithValue(req.Context(), RequestIdContextKey, requestID)
-
-	list, err := r.Storage.List(ctx)
+	files, err := r.Storage.List(ctx)
 	if err != nil {
 		r.logger.ErrorContext(ctx, "storage.List() err", slog.String("err", err.Error()))
-		return err
+		return nil, err
 	}
 
-	return eCtx.JSON(http.StatusOK, r.getRocksList(ctx, list))
-}
-
+	r.loadMetadata(ctx, files)
+	list := r.getRocksList(ctx, files)
+	if r.Upstream != nil {
+		name := "manifest"
+		if luaVersion != "" {
+			name += "-" + luaVersion
+		}
 
-func (r *Repository) GetManifestZip(eCtx echo.Context) error {
-	req := eCtx.Request()
-	resp := eCtx.Response()
-	requestID := req.Header.Get(echo.HeaderXRequestID)
-	if requestID == "" {
-		requestID = resp.Header().Get(echo.HeaderXRequestID)
+		upList, err := r.Upstream.Manifest(ctx, name)
+		if err != nil {
+			r.logger.WarnContext(ctx, "upstream manifest is unavailable, only local rocks are listed",
+				slog.String("manifest", name),
+				slog.String("err", err.Error()),
+			)
+		} else {
+			list.Merge(upList)
+		}
 	}
 
-	ctx := context.WithValue(req.Context(), RequestIdContextKey, requestID)
-	list, err := r.Storage.List(ctx)
-	if err != nil {
-		r.logger.ErrorContext(ctx, "storage.List() err", slog.String("err", err.Error()))
-		return err
+	if luaVersion == "" {
+		return list, nil
 	}
 
-	var (
-		filename, _ = strings.CutSuffix(filepath.Base(req.URL.Path), filepath.Ext(req.URL.Path))
-		archive = zip.NewWriter(resp)
-		f io.Writer
-	)
-
-	defer archive.Close()
-	f, err = archive.Create(filename)
-	if err != nil {
-		r.logger.ErrorContext(ctx, "unable to create archive",
-			slog.String("err", err.Error()),
-			slog.String("filename", filename),
-		)
+	return list.FilterByLua(luaVersion), nil
+}
 
-		return err
-	}
-	writer := luarocks.NewWriter(f)
-	if err = writer.WriteRepositoryPackages(r.getRocksList(ctx, list)); err != nil {
-		return err
+// manifestName - cuts .json and .zip extensions from a manifest request path
+func manifestName(p string) string {
+	name := filepath.Base(p)
+	for _, ext := range []string{".json", ".zip"} {
+		if n, found := strings.CutSuffix(name, ext); found {
+			return n
+		}
 	}
 
-	return nil
+	return name
 }
 
-
 func (r *Repository) getRocksList(ctx context.Context, list []string) luarocks.RocksList {
-	var (
-		rocks = make(luarocks.RocksList, 0, len(list))
-		fileName, rockName, version, arch string
-		found bool
-		index int
-	)
-
-	for _, fileName = range list {
-		if fileName, found = strings.CutSuffix(fileName, ".rockspec"); found {
-			arch = "rockspec"
-		} else if fileName, found = strings.CutSuffix(fileName, ".rock"); found {
-			arch = fileName[strings.LastIndexByte(fileName, '.') + 1:]
-			fileName, _ = strings.CutSuffix(fileName, fileName[strings.LastIndexByte(fileName, '.'):])
-		} else {
-			r.logger.DebugContext(ctx, "unable to define file arch", slog.String("filename", fileName))
+	rocks := make(luarocks.RocksList, 0, len(list))
+	for _, file := range list {
+		rockName, version, arch, err := luarocks.ParseFilename(file)
+		if err != nil {
+			r.logger.DebugContext(ctx, "unable to parse filename",
+				slog.String("filename", file),
+				slog.String("err", err.Error()),
+			)
 			continue
 		}
 
-		if index = strings.Index(fileName, "scm"); index > 0 {
-			version = fileName[index:]
-			rockName = fileName[:index-1]
-		} else {
-			match := semverRegexp.FindAllString(fileName, 1)
-			if len(match) == 0 {
-				r.logger.DebugContext(ctx, "unable to parse version", slog.String("filename", fileName))
-				continue
-			}
-
-			version = match[0]
-			rockName, _ = strings.CutSuffix(fileName, version)
+		v := rocks.Add(rockName, version, arch)
+		if spec, ok := r.specs.Get(file); ok && spec != nil {
+			v.Dependencies = spec.Dependencies
+			v.AddProvides(spec.Provides)
+		}
+
+		if provides, ok := r.rocks.Get(file); ok && provides != nil {
+			v.AddProvides(*provides)
 		}
-		rocks.Add(strings.TrimRight(rockName, "-."), version, arch)
 	}
 
 	return rocks
-}
\ No newline at end of file
+}
@@ -2,12 +2,22 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"io"
 	"log/slog"
+	pstorage "lua-mountain/pkg/storage"
 	"net/http"
 	"os"
+	"strings"
+)
+
+const (
+	// HeaderChecksumSHA256 - an optional sum of an uploaded file, a file is not stored on mismatch
+	HeaderChecksumSHA256 = "X-Checksum-Sha256"
 )
 
 func (r *Repository) Put(eCtx echo.Context) error {
@@ -30,16 +40,43 @@ func (r *Repository) Put(eCtx echo.Context) error {
 	filename := eCtx.Param("filename")
 	ctx := context.WithValue(req.Context(), RequestIdContextKey, requestID)
 
+	// a body shorter than Content-Length or a broken one must not replace a stored file
+	exp := pstorage.Expectation{Size: req.ContentLength, SHA256: req.Header.Get(HeaderChecksumSHA256)}
+	if exp.SHA256 != "" && !isSHA256(exp.SHA256) {
+		return echo.NewHTTPError(http.StatusBadRequest, HeaderChecksumSHA256+" must be a hex encoded sha256 sum")
+	}
+
+	ctx = pstorage.WithExpectation(ctx, exp)
+
+	dryRun := isTrue(eCtx.QueryParam("dry_run"))
+	defer eCtx.Request().Body.Close()
+
+	body := io.LimitReader(eCtx.Request().Body, req.ContentLength)
+	if err := r.store(ctx, filename, body, dryRun); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return eCtx.JSON(http.StatusOK, map[string]string{
+			"message": fmt.Sprintf("file %s is valid", filename),
+		})
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
+
+// store - checks a rewrite permission, validates and saves a file. Client errors are returned as *echo.HTTPError.
+// In dry run mode a file is only validated
+func (r *Repository) store(ctx context.Context, filename string, body io.Reader, dryRun bool) error {
+	// a fast path, an upload is not validated, when a file exists. Storages, which implement
+	// storage.Creator, check it again atomically on write
 	if !r.AllowRewrite {
 		r.logger.Debug("rewrite is not allowed, checking file existence", slog.String("filename", filename))
 		err := r.Storage.Exists(ctx, filename)
 		switch {
 		case err == nil:
-			return echo.NewHTTPError(
-				http.StatusConflict,
-				fmt.Sprintf("file %s exists, rewrite is disabled", filename),
-			)
-		case os.IsNotExist(err):
+			return rewriteDisabled(filename)
+		case errors.Is(err, os.ErrNotExist):
 		default:
 			r.logger.ErrorContext(ctx, "storage.Exists() call err",
 				slog.String("err", err.Error()),
@@ -48,11 +85,54 @@ func (r *Repository) Put(eCtx echo.Context) error {
 		}
 	}
 
-	body := io.LimitReader(eCtx.Request().Body, req.ContentLength)
-	defer eCtx.Request().Body.Close()
+	if validator := validatorFor(filename); validator != nil {
+		tmp, size, err := spool(body)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "unable to spool upload",
+				slog.String("err", err.Error()),
+				slog.String("filename", filename),
+			)
+			return err
+		}
+
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
 
-	if err := r.Storage.Put(ctx, filename, body); err != nil {
-		r.logger.ErrorContext(ctx, "storage.Put() err",
+		if err = validator(ctx, filename, tmp, size); err != nil {
+			var vErr *ValidationError
+			if errors.As(err, &vErr) {
+				r.logger.InfoContext(ctx, "upload rejected",
+					slog.String("err", err.Error()),
+					slog.String("filename", filename),
+				)
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			return err
+		}
+
+		body = io.NewSectionReader(tmp, 0, size)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	// even failed upload may change a stored file
+	defer r.invalidate(filename)
+	if err := r.write(ctx, filename, body); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return rewriteDisabled(filename)
+		}
+
+		if errors.Is(err, pstorage.ErrUnexpectedContent) {
+			r.logger.InfoContext(ctx, "upload rejected", slog.String("err", err.Error()))
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		r.logger.ErrorContext(ctx, "storage write err",
 			slog.String("err", err.Error()),
 			slog.String("filename", filename),
 		)
@@ -60,5 +140,36 @@ func (r *Repository) Put(eCtx echo.Context) error {
 		return err
 	}
 
-	return eCtx.NoContent(http.StatusNoContent)
+	return nil
+}
+
+// write - without a rewrite permission a file is created only if it is absent, when a storage supports it
+func (r *Repository) write(ctx context.Context, filename string, body io.Reader) error {
+	if creator, ok := r.Storage.(pstorage.Creator); ok && !r.AllowRewrite {
+		return creator.Create(ctx, filename, body)
+	}
+
+	return r.Storage.Put(ctx, filename, body)
+}
+
+func rewriteDisabled(filename string) error {
+	return echo.NewHTTPError(
+		http.StatusConflict,
+		fmt.Sprintf("file %s exists, rewrite is disabled", filename),
+	)
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// isTrue - query flags like ?dry_run=1 or ?dry_run=true
+func isTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+
+	return false
 }
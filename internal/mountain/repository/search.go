@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"lua-mountain/internal/mountain/luarocks"
+)
+
+type (
+	// SearchResult - rocks, which provide a module or a command
+	SearchResult struct {
+		Name  string        `json:"name"`
+		Rocks []RockVersion `json:"rocks"`
+	}
+
+	RockVersion struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+)
+
+// SearchModule - answers which rocks provide a lua module, like require("socket.http")
+func (r *Repository) SearchModule(eCtx echo.Context) error {
+	return r.search(eCtx, "module")
+}
+
+// SearchCommand - answers which rocks install a command
+func (r *Repository) SearchCommand(eCtx echo.Context) error {
+	return r.search(eCtx, "command")
+}
+
+func (r *Repository) search(eCtx echo.Context, kind string) error {
+	requestID := eCtx.Request().Header.Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = eCtx.Response().Header().Get(echo.HeaderXRequestID)
+	}
+
+	ctx := context.WithValue(eCtx.Request().Context(), RequestIdContextKey, requestID)
+	name := eCtx.Param("name")
+
+	// an index is built once per manifest generation, like manifest snapshots
+	idx, err := r.manifests.Index(ctx, func(ctx context.Context) (luarocks.RocksList, error) {
+		return r.rocksList(ctx, "")
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	if kind == "module" {
+		ids = idx.modules.LookupModule(name)
+	} else {
+		ids = idx.commands[name]
+	}
+
+	if len(ids) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, name))
+	}
+
+	result := SearchResult{Name: name, Rocks: make([]RockVersion, 0, len(ids))}
+	for _, id := range ids {
+		rock, version, _ := strings.Cut(id, "/")
+		result.Rocks = append(result.Rocks, RockVersion{Name: rock, Version: version})
+	}
+
+	return eCtx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"lua-mountain/internal/mountain/luarocks"
+)
+
+const (
+	specsLoadConcurrency = 8
+)
+
+type (
+	// fileCache - parsed metadata of stored files by filename. Broken files are cached as nil,
+	// so they are not downloaded again until a file will be rewritten
+	fileCache[T any] struct {
+		mut   sync.RWMutex
+		items map[string]T
+	}
+)
+
+func newFileCache[T any]() *fileCache[T] {
+	return &fileCache[T]{items: make(map[string]T, 100)}
+}
+
+func (fc *fileCache[T]) Get(filename string) (item T, ok bool) {
+	fc.mut.RLock()
+	defer fc.mut.RUnlock()
+
+	item, ok = fc.items[filename]
+	return
+}
+
+func (fc *fileCache[T]) Store(filename string, item T) {
+	fc.mut.Lock()
+	defer fc.mut.Unlock()
+
+	fc.items[filename] = item
+}
+
+func (fc *fileCache[T]) Invalidate(filename string) {
+	fc.mut.Lock()
+	defer fc.mut.Unlock()
+
+	delete(fc.items, filename)
+}
+
+// loadMetadata - reads and parses rockspecs and rock archives, which are not cached yet
+func (r *Repository) loadMetadata(ctx context.Context, files []string) {
+	var g errgroup.Group
+	g.SetLimit(specsLoadConcurrency)
+
+	for _, filename := range files {
+		filename := filename
+		switch {
+		case strings.HasSuffix(filename, ".rockspec"):
+			if _, ok := r.specs.Get(filename); ok {
+				continue
+			}
+
+			g.Go(func() error {
+				r.loadRockspec(ctx, filename)
+				return nil
+			})
+		case strings.HasSuffix(filename, ".rock"):
+			if _, ok := r.rocks.Get(filename); ok {
+				continue
+			}
+
+			g.Go(func() error {
+				r.loadRock(ctx, filename)
+				return nil
+			})
+		}
+	}
+
+	_ = g.Wait()
+}
+
+func (r *Repository) loadRockspec(ctx context.Context, filename string) {
+	f, err := r.Storage.Get(ctx, filename)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unable to read rockspec",
+			slog.String("filename", filename),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	defer f.Close()
+	spec, err := luarocks.ParseRockspec(ctx, f)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unable to parse rockspec",
+			slog.String("filename", filename),
+			slog.String("err", err.Error()),
+		)
+
+		if isTransient(ctx, err) {
+			return
+		}
+	}
+
+	r.specs.Store(filename, spec)
+}
+
+// isTransient - errors of cancelled requests and timeouts are not cached, a file is parsed by a next request
+func isTransient(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// loadRock - reads modules and commands of a rock archive. Archives must be seekable,
+// so files of non-local storages are spooled into temporary files
+func (r *Repository) loadRock(ctx context.Context, filename string) {
+	f, err := r.Storage.Get(ctx, filename)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unable to read rock",
+			slog.String("filename", filename),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	defer f.Close()
+	tmp, size, err := spool(f)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unable to spool rock",
+			slog.String("filename", filename),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	archive, err := luarocks.OpenRock(ctx, tmp, size, filename, luarocks.DefaultArchiveLimits)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unable to open rock",
+			slog.String("filename", filename),
+			slog.String("err", err.Error()),
+		)
+
+		if !isTransient(ctx, err) {
+			r.rocks.Store(filename, nil)
+		}
+
+		return
+	}
+
+	provides := archive.Provides()
+	r.rocks.Store(filename, &provides)
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"lua-mountain/internal/mountain/luarocks"
+	"lua-mountain/internal/mountain/storage"
+	"lua-mountain/pkg/slogan"
+	pstorage "lua-mountain/pkg/storage"
+)
+
+const (
+	defaultUpstreamTimeout     = time.Second * 30
+	defaultUpstreamManifestTTL = time.Minute * 5
+)
+
+type (
+	UpstreamConfig struct {
+		Url         string        `yaml:"url"`
+		Timeout     time.Duration `yaml:"timeout"`
+		ManifestTTL time.Duration `yaml:"manifest_ttl"`
+	}
+
+	// Upstream - remote rocks server, used by proxy repositories
+	Upstream struct {
+		Url         *url.URL
+		Client      *http.Client
+		ManifestTTL time.Duration
+		logger      *slog.Logger
+		group       singleflight.Group
+		mut         sync.Mutex
+		manifests   map[string]*upstreamManifest
+	}
+
+	upstreamManifest struct {
+		list    luarocks.RocksList
+		fetched time.Time
+	}
+)
+
+func NewUpstream(cfg *UpstreamConfig, logger *slog.Logger) (*Upstream, error) {
+	u, err := url.Parse(cfg.Url)
+	if err != nil {
+		return nil, fmt.Errorf("upstream url parse err: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("upstream url %s must be absolute", cfg.Url)
+	}
+
+	up := &Upstream{
+		Url:         u,
+		Client:      &http.Client{Timeout: cfg.Timeout},
+		ManifestTTL: cfg.ManifestTTL,
+		logger:      logger.With(slogan.SanitizedURL("upstream", u)),
+		manifests:   make(map[string]*upstreamManifest, 5),
+	}
+
+	if up.Client.Timeout == 0 {
+		up.Client.Timeout = defaultUpstreamTimeout
+	}
+
+	if up.ManifestTTL == 0 {
+		up.ManifestTTL = defaultUpstreamManifestTTL
+	}
+
+	return up, nil
+}
+
+// Fetch - requests a file from upstream, caller must close a body. A size is Content-Length of a response,
+// it's -1, when it is unknown. Missing files are reported as os.ErrNotExist
+func (u *Upstream) Fetch(ctx context.Context, filename string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Url.JoinPath(filename).String(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("upstream request build err: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("upstream request err: %w", err)
+	}
+
+	u.logger.DebugContext(ctx, "upstream request end",
+		slog.String("filename", filename),
+		slog.String("status", resp.Status),
+		slog.Duration("dur", time.Since(start)),
+	)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("upstream: %s: %w", filename, os.ErrNotExist)
+	case resp.StatusCode < http.StatusOK || resp.StatusCode > 299:
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("upstream: GET %s END=%d", filename, resp.StatusCode)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// Pull - downloads a file from upstream into the storage. Concurrent pulls of a same file are executed once,
+// a pull is not cancelled by a caller, which leaves, it's limited by a timeout of a fetch and of a write
+func (u *Upstream) Pull(ctx context.Context, filename string, st storage.Storage) error {
+	_, err := shared(ctx, &u.group, filename, u.Client.Timeout*2, func(ctx context.Context) (any, error) {
+		body, size, err := u.Fetch(ctx, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		defer body.Close()
+		// a truncated body must not be cached as a file
+		ctx = pstorage.WithExpectation(ctx, pstorage.Expectation{Size: size})
+		if err = st.Put(ctx, filename, body); err != nil {
+			return nil, fmt.Errorf("upstream: unable to cache %s: %w", filename, err)
+		}
+
+		u.logger.InfoContext(ctx, "file cached from upstream", slog.String("filename", filename))
+		return nil, nil
+	})
+
+	return err
+}
+
+// Manifest - returns an upstream manifest by name (manifest, manifest-5.1, ...), manifests are cached for ManifestTTL.
+// If upstream is unavailable, a stale copy is returned
+func (u *Upstream) Manifest(ctx context.Context, name string) (luarocks.RocksList, error) {
+	u.mut.Lock()
+	cached := u.manifests[name]
+	u.mut.Unlock()
+
+	if cached != nil && time.Since(cached.fetched) < u.ManifestTTL {
+		return cached.list, nil
+	}
+
+	// a fetch and an eval are limited by a client timeout each
+	v, err := shared(ctx, &u.group, "\x00"+name, u.Client.Timeout*2, func(ctx context.Context) (any, error) {
+		body, _, err := u.Fetch(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		defer body.Close()
+		// big manifests (luarocks.org) are evaluated longer than a default eval timeout
+		eCtx, done := context.WithTimeout(ctx, u.Client.Timeout)
+		defer done()
+
+		list, err := luarocks.ReadManifest(eCtx, body)
+		if err != nil {
+			return nil, fmt.Errorf("upstream: %s: %w", name, err)
+		}
+
+		u.mut.Lock()
+		u.manifests[name] = &upstreamManifest{list: list, fetched: time.Now()}
+		u.mut.Unlock()
+
+		return list, nil
+	})
+
+	if err != nil {
+		if cached != nil && !errors.Is(err, os.ErrNotExist) {
+			u.logger.WarnContext(ctx, "upstream manifest fetch err, stale copy used",
+				slog.String("manifest", name),
+				slog.String("err", err.Error()),
+				slog.Time("fetched", cached.fetched),
+			)
+			return cached.list, nil
+		}
+
+		return nil, err
+	}
+
+	return v.(luarocks.RocksList), nil
+}
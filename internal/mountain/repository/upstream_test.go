@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lua-mountain/internal/mountain/luarocks"
+	"lua-mountain/pkg/filesystem"
+)
+
+const (
+	testRockspec = `package = "foo"
+version = "1.0-1"
+source = {url = "https://example.com/foo-1.0-1.tar.gz"}
+dependencies = {"lua >= 5.3"}
+build = {type = "builtin", modules = {foo = "foo.lua"}}
+`
+	testManifest = `repository = {
+	foo = {
+		["1.0-1"] = {{arch = "rockspec", dependencies = {"lua >= 5.1"}}},
+		["0.9-1"] = {{arch = "rockspec"}, {arch = "src"}},
+	},
+	bar = {
+		["2.0-1"] = {{arch = "all"}},
+	},
+}
+`
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeUpstream - a rocks server of files, responses of a file may be replaced by a handler
+type fakeUpstream struct {
+	mut      sync.Mutex
+	files    map[string]string
+	handlers map[string]http.HandlerFunc
+	hits     map[string]*atomic.Int32
+}
+
+func newFakeUpstream(t *testing.T, files map[string]string) (*fakeUpstream, *httptest.Server) {
+	f := &fakeUpstream{
+		files:    files,
+		handlers: make(map[string]http.HandlerFunc),
+		hits:     make(map[string]*atomic.Int32),
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	f.mut.Lock()
+	if f.hits[name] == nil {
+		f.hits[name] = &atomic.Int32{}
+	}
+
+	f.hits[name].Add(1)
+	handler, ok := f.handlers[name]
+	content, exists := f.files[name]
+	f.mut.Unlock()
+
+	switch {
+	case ok:
+		handler(w, r)
+	case exists:
+		_, _ = io.WriteString(w, content)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeUpstream) Handle(name string, handler http.HandlerFunc) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	f.handlers[name] = handler
+}
+
+func (f *fakeUpstream) Hits(name string) int {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	if f.hits[name] == nil {
+		return 0
+	}
+
+	return int(f.hits[name].Load())
+}
+
+func newTestProxy(t *testing.T, upstream string, manifestTTL time.Duration) (*Repository, *filesystem.Storage) {
+	st, err := filesystem.NewStorage(filesystem.WithStorageConfig(&filesystem.StorageConfig{
+		Dir:    t.TempDir(),
+		Logger: testLogger,
+	}))
+	if err != nil {
+		t.Fatalf("storage err: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	repo, err := New(ctx, &Config{
+		Prefix:   "/proxy",
+		Upstream: &UpstreamConfig{Url: upstream, Timeout: time.Second * 5, ManifestTTL: manifestTTL},
+	}, st, testLogger)
+	if err != nil {
+		t.Fatalf("repository err: %v", err)
+	}
+
+	return repo, st
+}
+
+func readAll(t *testing.T, r io.ReadCloser) string {
+	t.Helper()
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+
+	return string(content)
+}
+
+func TestProxyGet(t *testing.T) {
+	up, srv := newFakeUpstream(t, map[string]string{"foo-1.0-1.rockspec": testRockspec})
+	up.Handle("broken-1.0-1.rockspec", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	repo, st := newTestProxy(t, srv.URL, 0)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		f, err := repo.open(ctx, "foo-1.0-1.rockspec")
+		if err != nil {
+			t.Fatalf("open %d: unexpected err: %v", i, err)
+		}
+
+		if got := readAll(t, f); got != testRockspec {
+			t.Errorf("open %d: got %q", i, got)
+		}
+	}
+
+	if hits := up.Hits("foo-1.0-1.rockspec"); hits != 1 {
+		t.Errorf("got %d upstream requests, a pulled file must be served by a storage", hits)
+	}
+
+	if err := st.Exists(ctx, "foo-1.0-1.rockspec"); err != nil {
+		t.Errorf("pulled file is not stored: %v", err)
+	}
+
+	if _, err := repo.open(ctx, "missing-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v, want os.ErrNotExist", err)
+	}
+
+	if _, err := repo.open(ctx, "broken-1.0-1.rockspec"); !errors.Is(err, errUpstream) {
+		t.Errorf("broken upstream: got %v, want errUpstream", err)
+	}
+
+	if err := st.Exists(ctx, "broken-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("broken upstream: file is stored: %v", err)
+	}
+}
+
+// TestProxyPullLeavingCaller - a caller, which leaves, does not fail other callers of a same pull
+func TestProxyPullLeavingCaller(t *testing.T) {
+	up, srv := newFakeUpstream(t, nil)
+	started, release := make(chan struct{}), make(chan struct{})
+	up.Handle("foo-1.0-1.rockspec", func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, testRockspec)
+	})
+
+	repo, _ := newTestProxy(t, srv.URL, 0)
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := repo.open(first, "foo-1.0-1.rockspec")
+		firstErr <- err
+	}()
+
+	<-started
+	type result struct {
+		content string
+		err     error
+	}
+
+	second := make(chan result, 1)
+	go func() {
+		f, err := repo.open(context.Background(), "foo-1.0-1.rockspec")
+		if err != nil {
+			second <- result{err: err}
+			return
+		}
+
+		content, err := io.ReadAll(f)
+		f.Close()
+		second <- result{content: string(content), err: err}
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first caller: got %v, want context.Canceled", err)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+
+	res := <-second
+	if res.err != nil || res.content != testRockspec {
+		t.Fatalf("second caller: got %q, %v", res.content, res.err)
+	}
+
+	if hits := up.Hits("foo-1.0-1.rockspec"); hits != 1 {
+		t.Errorf("got %d upstream requests, want 1", hits)
+	}
+}
+
+// TestProxyPullTruncated - a body shorter than Content-Length is not cached
+func TestProxyPullTruncated(t *testing.T) {
+	up, srv := newFakeUpstream(t, nil)
+	up.Handle("foo-1.0-1.rockspec", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		_, _ = io.WriteString(w, testRockspec[:10])
+	})
+
+	repo, st := newTestProxy(t, srv.URL, 0)
+	ctx := context.Background()
+	if _, err := repo.open(ctx, "foo-1.0-1.rockspec"); !errors.Is(err, errUpstream) {
+		t.Fatalf("got %v, want errUpstream", err)
+	}
+
+	if err := st.Exists(ctx, "foo-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("truncated file is stored: %v", err)
+	}
+
+	entries, err := os.ReadDir(st.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if filesystem.IsTemp(entry.Name()) {
+			t.Errorf("temp file %s is left", entry.Name())
+		}
+	}
+}
+
+// TestUpstreamManifestStale - a cached manifest is used, when upstream fails, but not when a manifest is removed
+func TestUpstreamManifestStale(t *testing.T) {
+	up, srv := newFakeUpstream(t, map[string]string{"manifest": testManifest})
+	repo, _ := newTestProxy(t, srv.URL, time.Nanosecond)
+	ctx := context.Background()
+
+	list, err := repo.Upstream.Manifest(ctx, "manifest")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("got %d rocks, want 2", len(list))
+	}
+
+	up.Handle("manifest", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	stale, err := repo.Upstream.Manifest(ctx, "manifest")
+	if err != nil {
+		t.Fatalf("stale copy is expected, got err: %v", err)
+	}
+
+	if len(stale) != len(list) {
+		t.Errorf("got %d rocks of a stale copy, want %d", len(stale), len(list))
+	}
+
+	if hits := up.Hits("manifest"); hits != 2 {
+		t.Errorf("got %d upstream requests, an expired manifest must be refetched", hits)
+	}
+
+	up.Handle("manifest", http.NotFound)
+	if _, err = repo.Upstream.Manifest(ctx, "manifest"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("removed manifest: got %v, want os.ErrNotExist", err)
+	}
+}
+
+// TestProxyManifestMerge - local files are listed with upstream ones, local metadata has a priority
+func TestProxyManifestMerge(t *testing.T) {
+	_, srv := newFakeUpstream(t, map[string]string{"manifest": testManifest})
+	repo, st := newTestProxy(t, srv.URL, 0)
+	ctx := context.Background()
+
+	if err := st.Put(ctx, "foo-1.0-1.rockspec", strings.NewReader(testRockspec)); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := repo.rocksList(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	names := make([]string, 0, len(list))
+	for _, rock := range list {
+		names = append(names, rock.Name)
+	}
+
+	if !slices.Equal(names, []string{"bar", "foo"}) {
+		t.Fatalf("got rocks %q, want bar and foo", names)
+	}
+
+	foo := list[slices.IndexFunc(list, func(rock *luarocks.Rock) bool { return rock.Name == "foo" })]
+	local := foo.SearchVersion("1.0-1")
+	if local == nil || !slices.Equal(local.Dependencies, []string{"lua >= 5.3"}) {
+		t.Errorf("local version must keep its dependencies, got %+v", local)
+	}
+
+	if v := foo.SearchVersion("0.9-1"); v == nil || !slices.Equal(v.Arch, []string{"rockspec", "src"}) {
+		t.Errorf("upstream version is not merged, got %+v", v)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"lua-mountain/internal/mountain/luarocks"
+)
+
+type (
+	// Validator - checks an uploaded file before it is stored
+	Validator func(ctx context.Context, filename string, f io.ReaderAt, size int64) error
+
+	// ValidationError - a file is broken, such errors are returned to a client with 4xx status
+	ValidationError struct {
+		Filename string
+		Err      error
+	}
+)
+
+var (
+	// validators - upload checks by file extension
+	validators = map[string]Validator{
+		".rockspec": ValidateRockspec,
+		".rock":     ValidateRock,
+	}
+)
+
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("%s is invalid: %s", ve.Filename, ve.Err.Error())
+}
+
+func (ve *ValidationError) Unwrap() error {
+	return ve.Err
+}
+
+// ValidateRockspec - evaluates a rockspec and checks its required fields and filename
+func ValidateRockspec(ctx context.Context, filename string, f io.ReaderAt, size int64) error {
+	if size > luarocks.MaxRockspecSize {
+		return &ValidationError{
+			Filename: filename,
+			Err:      fmt.Errorf("max allowed rockspec size %d, got %d", luarocks.MaxRockspecSize, size),
+		}
+	}
+
+	spec, err := luarocks.ParseRockspec(ctx, io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return &ValidationError{Filename: filename, Err: err}
+	}
+
+	if err = spec.Validate(filename); err != nil {
+		return &ValidationError{Filename: filename, Err: err}
+	}
+
+	return nil
+}
+
+// ValidateRock - checks a rock archive: entries, inner rockspec and rock_manifest checksums
+func ValidateRock(ctx context.Context, filename string, f io.ReaderAt, size int64) error {
+	if _, err := luarocks.OpenRock(ctx, f, size, filename, luarocks.DefaultArchiveLimits); err != nil {
+		return &ValidationError{Filename: filename, Err: err}
+	}
+
+	return nil
+}
+
+func validatorFor(filename string) Validator {
+	for ext, validator := range validators {
+		if strings.HasSuffix(filename, ext) {
+			return validator
+		}
+	}
+
+	return nil
+}
+
+// spool - saves a body into a temporary file, so it can be validated and read again.
+// Caller must close and remove the file
+func spool(r io.Reader) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "mountain-upload-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+
+	return tmp, size, nil
+}
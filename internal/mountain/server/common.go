@@ -1,29 +1,113 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	slogecho "github.com/samber/slog-echo"
-	"lua-mountain/internal/mountain/logging"
 )
 
 type (
 	Config struct {
 		Address string `yaml:"address"`
-		Port string `yaml:"port"`
+		Port    string `yaml:"port"`
+		// TLS - serves https, when set
+		TLS *TLSConfig `yaml:"tls"`
+		// ShutdownTimeout - how long in-flight requests are waited on stop
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	}
+
+	// Handler - routes, which can be replaced while serving.
+	// In-flight requests are finished by routes, which accepted them
+	Handler struct {
+		current atomic.Pointer[http.Handler]
 	}
 )
 
-func Init() *echo.Echo {
+const (
+	DefaultShutdownTimeout = time.Second * 30
+)
+
+// Init - creates routes with an access log, redactPath hides secrets of logged paths, it may be nil
+func Init(logger *slog.Logger, redactPath func(string) string) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
 
+	if redactPath != nil {
+		logger = slog.New(&pathRedactor{Handler: logger.Handler(), redact: redactPath})
+	}
+
 	e.Use(
-		slogecho.New(logging.DefaultLogger),
+		slogecho.New(logger),
 		middleware.RequestID(),
 		middleware.Recover(),
 	)
 
 	return e
 }
+
+func (h *Handler) Swap(handler http.Handler) {
+	h.current.Store(&handler)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	(*h.current.Load()).ServeHTTP(w, req)
+}
+
+// Serve - serves requests until ctx is done, then stops accepting new connections
+// and waits in-flight requests for a shutdown timeout
+func Serve(ctx context.Context, s *http.Server, timeout time.Duration, logger *slog.Logger) error {
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("listen err: %w", err)
+	}
+
+	if s.TLSConfig != nil {
+		ln = tls.NewListener(ln, s.TLSConfig)
+	}
+
+	if s.ErrorLog == nil {
+		s.ErrorLog = slog.NewLogLogger(logger.Handler(), slog.LevelWarn)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, waiting in-flight requests", slog.Duration("timeout", timeout))
+	sCtx, done := context.WithTimeout(context.Background(), timeout)
+	defer done()
+
+	if err := s.Shutdown(sCtx); err != nil {
+		s.Close()
+		return fmt.Errorf("graceful shutdown err: %w", err)
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logger.Info("server stopped")
+	return nil
+}
@@ -10,12 +10,8 @@ import (
 func AllowedExtensions(extensions []string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			filename := c.Param("filename")
-			if !IsAllowedExtension(filename, extensions) {
-				return echo.NewHTTPError(
-					http.StatusBadRequest,
-					fmt.Sprintf("filename %s has not allowed extension, allowed are: %v", filename, extensions),
-				)
+			if err := CheckExtension(c.Param("filename"), extensions); err != nil {
+				return err
 			}
 
 			return next(c)
@@ -23,6 +19,18 @@ func AllowedExtensions(extensions []string) echo.MiddlewareFunc {
 	}
 }
 
+// CheckExtension - returns a client error, when a filename has not allowed extension
+func CheckExtension(filename string, extensions []string) error {
+	if !IsAllowedExtension(filename, extensions) {
+		return echo.NewHTTPError(
+			http.StatusBadRequest,
+			fmt.Sprintf("filename %s has not allowed extension, allowed are: %v", filename, extensions),
+		)
+	}
+
+	return nil
+}
+
 func IsAllowedExtension(filename string, allowed []string) bool {
 	// TODO: may be use regular expression
 	for _, ext := range allowed {
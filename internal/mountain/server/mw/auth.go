@@ -0,0 +1,70 @@
+package mw
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"lua-mountain/internal/mountain/auth"
+)
+
+const (
+	// PrincipalKey - echo context key of an authenticated principal
+	PrincipalKey = "principal"
+)
+
+// Auth - authenticates a request and checks principal permissions on an operation of all repositories,
+// like a group and its members. Requests without credentials are allowed to read, when anonymousRead is set
+func Auth(authenticator auth.Authenticator, repositories []string, op auth.Operation, anonymousRead bool, logger *slog.Logger) echo.MiddlewareFunc {
+	repository := repositories[0]
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, err := authenticator.Authenticate(c.Request())
+			switch {
+			case err == nil:
+			case errors.Is(err, auth.ErrNoCredentials):
+				if op == auth.OpRead && anonymousRead {
+					return next(c)
+				}
+
+				return unauthorized(c, "authentication required")
+			case errors.Is(err, auth.ErrInvalidCredentials):
+				logger.InfoContext(c.Request().Context(), "authentication failed",
+					slog.String("repository", repository),
+					slog.String("err", err.Error()),
+				)
+				return unauthorized(c, "invalid credentials")
+			default:
+				return err
+			}
+
+			for _, r := range repositories {
+				if principal.Can(r, op) {
+					continue
+				}
+
+				logger.InfoContext(c.Request().Context(), "access denied",
+					slog.String("principal", principal.Name),
+					slog.String("repository", repository),
+					slog.String("denied", r),
+					slog.String("operation", string(op)),
+				)
+				return echo.NewHTTPError(
+					http.StatusForbidden,
+					fmt.Sprintf("%s is not allowed to %s in %s", principal.Name, op, r),
+				)
+			}
+
+			c.Set(PrincipalKey, principal)
+			return next(c)
+		}
+	}
+}
+
+func unauthorized(c echo.Context, msg string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="mountain"`)
+	return echo.NewHTTPError(http.StatusUnauthorized, msg)
+}
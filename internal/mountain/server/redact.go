@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+)
+
+const (
+	// accessLogRequestKey, accessLogPathKey - a request path of an access log record is request.path
+	accessLogRequestKey = "request"
+	accessLogPathKey    = "path"
+)
+
+// pathRedactor - rewrites request paths of access log records
+type pathRedactor struct {
+	slog.Handler
+	redact func(string) string
+}
+
+func (h *pathRedactor) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.attr(attr))
+		return true
+	})
+
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h *pathRedactor) attr(attr slog.Attr) slog.Attr {
+	if attr.Key != accessLogRequestKey || attr.Value.Kind() != slog.KindGroup {
+		return attr
+	}
+
+	group := attr.Value.Group()
+	attrs := make([]slog.Attr, len(group))
+	for i, a := range group {
+		if a.Key == accessLogPathKey {
+			a = slog.String(a.Key, h.redact(a.Value.String()))
+		}
+
+		attrs[i] = a
+	}
+
+	return slog.Attr{Key: attr.Key, Value: slog.GroupValue(attrs...)}
+}
+
+func (h *pathRedactor) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &pathRedactor{Handler: h.Handler.WithAttrs(attrs), redact: h.redact}
+}
+
+func (h *pathRedactor) WithGroup(name string) slog.Handler {
+	return &pathRedactor{Handler: h.Handler.WithGroup(name), redact: h.redact}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type (
+	TLSConfig struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+		// MinVersion - 1.2 or 1.3, default is 1.2
+		MinVersion string `yaml:"min_version"`
+		// ClientCAFile - CA bundle for client certificates verification, enables mutual tls
+		ClientCAFile string `yaml:"client_ca_file"`
+		// ClientAuth - "require" rejects connections without a valid certificate,
+		// "verify_if_given" (default) allows anonymous clients
+		ClientAuth string `yaml:"client_auth"`
+	}
+
+	// TLS - server certificates and client CA, which are reloaded on change of their files
+	TLS struct {
+		cfg    TLSConfig
+		base   *tls.Config
+		state  atomic.Pointer[tlsState]
+		logger *slog.Logger
+	}
+
+	tlsState struct {
+		cert      *tls.Certificate
+		clientCAs *x509.CertPool
+	}
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"":    tls.VersionTLS12,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+func NewTLS(ctx context.Context, cfg *TLSConfig, logger *slog.Logger) (*TLS, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls: cert_file and key_file are required")
+	}
+
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("tls: unsupported min_version %q, supported are 1.2 and 1.3", cfg.MinVersion)
+	}
+
+	t := &TLS{
+		cfg:    *cfg,
+		base:   &tls.Config{MinVersion: minVersion},
+		logger: logger.With(slog.String("component", "tls")),
+	}
+
+	if cfg.ClientCAFile != "" {
+		switch cfg.ClientAuth {
+		case "", "verify_if_given":
+			t.base.ClientAuth = tls.VerifyClientCertIfGiven
+		case "require":
+			t.base.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("tls: unsupported client_auth %q", cfg.ClientAuth)
+		}
+	}
+
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("tls: watcher err: %w", err)
+	}
+
+	for _, dir := range t.dirs() {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("tls: watcher err: %w", err)
+		}
+	}
+
+	go t.ReloadOnChange(ctx, watcher)
+
+	return t, nil
+}
+
+// Config - tls config for http.Server, every handshake uses the last loaded certificates
+func (t *TLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: t.base.MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			state := t.state.Load()
+			cfg := t.base.Clone()
+			cfg.Certificates = []tls.Certificate{*state.cert}
+			cfg.ClientCAs = state.clientCAs
+			return cfg, nil
+		},
+	}
+}
+
+// Load - reads certificates, on errors previous certificates are kept
+func (t *TLS) Load() error {
+	cert, err := tls.LoadX509KeyPair(t.cfg.CertFile, t.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: certificate load err: %w", err)
+	}
+
+	state := &tlsState{cert: &cert}
+	if t.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls: client ca read err: %w", err)
+		}
+
+		state.clientCAs = x509.NewCertPool()
+		if !state.clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates found in %s", t.cfg.ClientCAFile)
+		}
+	}
+
+	t.state.Store(state)
+	t.logger.Info("tls certificates loaded", slog.String("cert", t.cfg.CertFile))
+	return nil
+}
+
+func (t *TLS) ReloadOnChange(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	files := []string{filepath.Clean(t.cfg.CertFile), filepath.Clean(t.cfg.KeyFile)}
+	if t.cfg.ClientCAFile != "" {
+		files = append(files, filepath.Clean(t.cfg.ClientCAFile))
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !slices.Contains(files, filepath.Clean(event.Name)) || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+
+			// a cert and a key are usually replaced one by one, a failed load is retried by a next event
+			if err := t.Load(); err != nil {
+				t.logger.Warn("tls reload err, previous certificates are used", slog.String("err", err.Error()))
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			t.logger.Error("tls watcher err", slog.String("err", err.Error()))
+		case <-ctx.Done():
+			t.logger.Info("tls watcher stopped")
+			return
+		}
+	}
+}
+
+func (t *TLS) dirs() []string {
+	dirs := []string{filepath.Dir(t.cfg.CertFile), filepath.Dir(t.cfg.KeyFile)}
+	if t.cfg.ClientCAFile != "" {
+		dirs = append(dirs, filepath.Dir(t.cfg.ClientCAFile))
+	}
+
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
@@ -1,28 +1,92 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"time"
 
-	"lua-mountain/pkg/attr"
 	"lua-mountain/pkg/filesystem"
+	pstorage "lua-mountain/pkg/storage"
 )
 
 const (
+	FsType = "fs"
+	// LayoutKey - a key of fs config, which sets a layout
+	LayoutKey         = "layout"
 	DefaultStorageDir = "/var/mountain"
 )
 
-func InitFsStorage(name string, cfg map[string]any, logger *slog.Logger) (*filesystem.Storage, error) {
-	var (
-		sCfg = filesystem.StorageConfig{}
-		ok   bool
-	)
+type (
+	FsConfig struct {
+		Dir string `yaml:"dir"`
+		// StaleTempAge - temp files of interrupted uploads older than that are removed on start
+		StaleTempAge pstorage.Duration `yaml:"stale_temp_age"`
+		// Layout - flat, name or hash, see filesystem.Layout. An existing dir is converted by storage migrate command
+		Layout string `yaml:"layout"`
+		// Watch - List and Exists read an in-memory index, which is updated by file system events
+		Watch bool `yaml:"watch"`
+		// IndexResyncInterval - a watched index is fully rebuilt on interval, for missed events
+		IndexResyncInterval pstorage.Duration `yaml:"index_resync_interval"`
+	}
+)
+
+func init() {
+	pstorage.Register(FsType, pstorage.NewDriver(
+		func() *FsConfig {
+			return &FsConfig{
+				Dir:                 DefaultStorageDir,
+				StaleTempAge:        pstorage.Duration(filesystem.DefaultStaleTempAge),
+				Layout:              string(filesystem.LayoutFlat),
+				Watch:               true,
+				IndexResyncInterval: pstorage.Duration(filesystem.DefaultIndexResyncInterval),
+			}
+		},
+		func(ctx context.Context, name string, cfg *FsConfig, logger *slog.Logger) (pstorage.Storage, error) {
+			return InitFsStorage(ctx, name, cfg, logger)
+		},
+	))
+}
+
+func (cfg *FsConfig) Validate() error {
+	if cfg.Dir == "" {
+		return errors.New("dir is required")
+	}
+
+	if cfg.StaleTempAge <= 0 {
+		return errors.New("stale_temp_age must be positive")
+	}
+
+	if cfg.IndexResyncInterval <= 0 {
+		return errors.New("index_resync_interval must be positive")
+	}
+
+	if _, err := filesystem.ParseLayout(cfg.Layout); err != nil {
+		return err
+	}
+
+	return nil
+}
 
-	sCfg.Dir, ok = attr.GetTyped[string](cfg, "dir")
-	if !ok {
-		sCfg.Dir = DefaultStorageDir
+// InitFsStorage - creates a storage, a watched index is updated until ctx is done
+func InitFsStorage(ctx context.Context, name string, cfg *FsConfig, logger *slog.Logger) (*filesystem.Storage, error) {
+	sCfg := filesystem.StorageConfig{
+		Dir:          cfg.Dir,
+		StaleTempAge: time.Duration(cfg.StaleTempAge),
+		Layout:       filesystem.Layout(cfg.Layout),
 	}
 	sCfg.Logger = logger.With(slog.String("storage", name), slog.String("dir", sCfg.Dir))
-	sCfg.Logger.Info("loading new fs storage")
+	sCfg.Logger.Info("loading new fs storage", slog.String("layout", cfg.Layout))
+
+	st, err := filesystem.NewStorage(filesystem.WithStorageConfig(&sCfg))
+	if err != nil || !cfg.Watch {
+		return st, err
+	}
+
+	// a storage works without an index, files are read from a dir on each List
+	if err = st.Watch(ctx, time.Duration(cfg.IndexResyncInterval)); err != nil {
+		sCfg.Logger.Warn("fs index is disabled", slog.String("err", err.Error()))
+	}
 
-	return filesystem.NewStorage(filesystem.WithStorageConfig(&sCfg))
+	return st, nil
 }
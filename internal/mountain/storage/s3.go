@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"lua-mountain/pkg/s3"
+	pstorage "lua-mountain/pkg/storage"
+)
+
+type (
+	S3Config struct {
+		Endpoint       string            `yaml:"endpoint"`
+		Region         string            `yaml:"region"`
+		Bucket         string            `yaml:"bucket"`
+		Prefix         string            `yaml:"prefix"`
+		AccessKey      string            `yaml:"access_key"`
+		SecretKey      string            `yaml:"secret_key"`
+		ForcePathStyle bool              `yaml:"force_path_style"`
+		RequestTimeout pstorage.Duration `yaml:"request_timeout"`
+	}
+)
+
+func init() {
+	pstorage.Register("s3", pstorage.NewDriver(
+		func() *S3Config {
+			return &S3Config{Region: s3.DefaultRegion, RequestTimeout: pstorage.Duration(s3.DefaultClientTimeout)}
+		},
+		func(ctx context.Context, name string, cfg *S3Config, logger *slog.Logger) (pstorage.Storage, error) {
+			return InitS3Storage(ctx, name, cfg, logger)
+		},
+	))
+}
+
+func (cfg *S3Config) Validate() error {
+	if cfg.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+
+	if cfg.Endpoint != "" {
+		if err := pstorage.CheckURL(cfg.Endpoint); err != nil {
+			return fmt.Errorf("endpoint: %w", err)
+		}
+	}
+
+	if cfg.RequestTimeout < 0 {
+		return errors.New("request_timeout must be positive")
+	}
+
+	return nil
+}
+
+func InitS3Storage(ctx context.Context, name string, cfg *S3Config, logger *slog.Logger) (*s3.Storage, error) {
+	var (
+		sCfg = s3.StorageConfig{Prefix: cfg.Prefix}
+		cCfg = s3.HTTPClientConfig{
+			Bucket:         cfg.Bucket,
+			Endpoint:       cfg.Endpoint,
+			Region:         cfg.Region,
+			AccessKey:      cfg.AccessKey,
+			SecretKey:      cfg.SecretKey,
+			ForcePathStyle: cfg.ForcePathStyle,
+			Timeout:        time.Duration(cfg.RequestTimeout),
+		}
+	)
+
+	sLogger := logger.With(
+		slog.String("storage", name),
+		slog.String("bucket", cCfg.Bucket),
+		slog.String("prefix", sCfg.Prefix),
+	)
+	cCfg.Logger = sLogger
+
+	client, err := s3.NewHTTPClient(&cCfg)
+	if err != nil {
+		return nil, fmt.Errorf("s3 storage init err: %w", err)
+	}
+
+	sLogger.Info("loading new s3 storage")
+	return s3.NewStorage(ctx, client,
+		s3.WithStorageLogger(sLogger),
+		s3.WithStorageConfig(sCfg),
+	)
+}
@@ -1,6 +1,17 @@
 package filesystem
 
-import "os"
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// readDirBatch - a number of entries, which are read from a dir at once
+	readDirBatch = 1024
+)
 
 func CreateDirIfNotExists(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -14,3 +25,65 @@ func CreateDirIfNotExists(dir string) error {
 
 	return nil
 }
+
+// IsTemp - a temp file of an unfinished write
+func IsTemp(name string) bool {
+	return strings.HasPrefix(name, TempPrefix)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+	return d.Sync()
+}
+
+// readDir - calls fn for entries of a dir, entries are read by batches, so a large dir is not kept in memory
+func readDir(dir string, fn func(entry os.DirEntry) error) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+	for {
+		entries, err := d.ReadDir(readDirBatch)
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// walkFiles - calls fn for files of a storage dir and its subdirs up to maxDepth, rel is a dir of a file
+// relative to a storage dir. Lock files are skipped
+func walkFiles(dir string, maxDepth int, fn func(rel string, entry os.DirEntry) error) error {
+	var walk func(rel string, depth int) error
+	walk = func(rel string, depth int) error {
+		return readDir(path.Join(dir, rel), func(entry os.DirEntry) error {
+			if !entry.IsDir() {
+				return fn(rel, entry)
+			}
+
+			if depth < maxDepth && !(rel == "" && entry.Name() == LockDir) {
+				return walk(path.Join(rel, entry.Name()), depth+1)
+			}
+
+			return nil
+		})
+	}
+
+	return walk("", 0)
+}
@@ -0,0 +1,334 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	DefaultIndexResyncInterval = time.Minute * 5
+)
+
+type (
+	// fileIndex - names of stored files, it's updated by writes of a storage, by file system events
+	// and by full resyncs
+	fileIndex struct {
+		mut   sync.RWMutex
+		files map[string]struct{}
+		// syncedAt - a time of a last full resync
+		syncedAt time.Time
+		// events - a number of applied file system events since a last resync
+		events int
+		// pending - adds (true) and removes (false) made during a resync scan, they are reapplied by Replace,
+		// because a scan may miss them. It's nil, when a scan is not running
+		pending map[string]bool
+	}
+)
+
+func newFileIndex(files []string) *fileIndex {
+	idx := &fileIndex{}
+	idx.Replace(files)
+	return idx
+}
+
+func (idx *fileIndex) Has(filename string) bool {
+	idx.mut.RLock()
+	defer idx.mut.RUnlock()
+
+	_, ok := idx.files[filename]
+	return ok
+}
+
+func (idx *fileIndex) Add(filename string) {
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	idx.files[filename] = struct{}{}
+	if idx.pending != nil {
+		idx.pending[filename] = true
+	}
+}
+
+func (idx *fileIndex) Remove(filename string) {
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	delete(idx.files, filename)
+	if idx.pending != nil {
+		idx.pending[filename] = false
+	}
+}
+
+// Keys - sorted names, like names of os.ReadDir
+func (idx *fileIndex) Keys() []string {
+	idx.mut.RLock()
+	defer idx.mut.RUnlock()
+
+	keys := maps.Keys(idx.files)
+	slices.Sort(keys)
+	return keys
+}
+
+// StartScan - starts recording of adds and removes, which are made during a resync scan
+func (idx *fileIndex) StartScan() {
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	idx.pending = make(map[string]bool)
+}
+
+// StopScan - drops recorded changes of a failed scan
+func (idx *fileIndex) StopScan() {
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	idx.pending = nil
+}
+
+// Replace - sets names of a full resync, changes made since StartScan are applied over them.
+// Returns added and removed names, which were missed by events
+func (idx *fileIndex) Replace(files []string) (added, removed []string) {
+	next := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		next[f] = struct{}{}
+	}
+
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	for f, exists := range idx.pending {
+		if exists {
+			next[f] = struct{}{}
+		} else {
+			delete(next, f)
+		}
+	}
+
+	for f := range next {
+		if _, ok := idx.files[f]; !ok {
+			added = append(added, f)
+		}
+	}
+
+	for f := range idx.files {
+		if _, ok := next[f]; !ok {
+			removed = append(removed, f)
+		}
+	}
+
+	idx.files, idx.syncedAt, idx.events, idx.pending = next, time.Now(), 0, nil
+	return added, removed
+}
+
+func (idx *fileIndex) event() {
+	idx.mut.Lock()
+	defer idx.mut.Unlock()
+
+	idx.events++
+}
+
+// Age - a time since a last full resync and a number of events, which are applied since it
+func (idx *fileIndex) Age() (time.Duration, int) {
+	idx.mut.RLock()
+	defer idx.mut.RUnlock()
+
+	return time.Since(idx.syncedAt), idx.events
+}
+
+// Watch - builds an in-memory index of files, which is read by List and Exists. An index is updated by
+// file system events and fully resynced on interval, until ctx is done. File systems like NFS do not
+// deliver events of other hosts, files of other hosts become visible by Exists immediately and
+// by List after a resync
+func (s *Storage) Watch(ctx context.Context, resyncInterval time.Duration) error {
+	if resyncInterval <= 0 {
+		resyncInterval = DefaultIndexResyncInterval
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("fs watcher err: %w", err)
+	}
+
+	// a storage dir is watched before a scan, so shard dirs, which are created during a scan, are not missed
+	dirs := 1
+	err = watcher.Add(s.Dir)
+	if err == nil && s.Layout.Depth() > 0 {
+		err = readDir(s.Dir, func(entry os.DirEntry) error {
+			if !entry.IsDir() || entry.Name() == LockDir {
+				return nil
+			}
+
+			dirs++
+			return watcher.Add(filepath.Join(s.Dir, entry.Name()))
+		})
+	}
+
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("fs watcher err: %w", err)
+	}
+
+	files, err := s.listDir(ctx)
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("fs index build err: %w", err)
+	}
+
+	s.index = newFileIndex(files)
+	s.Logger.Info("fs index built", slog.Int("files", len(files)), slog.Int("dirs", dirs))
+
+	go s.UpdateIndexOnChange(ctx, watcher, resyncInterval)
+	return nil
+}
+
+func (s *Storage) UpdateIndexOnChange(ctx context.Context, watcher *fsnotify.Watcher, interval time.Duration) {
+	defer watcher.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			s.indexEvent(ctx, watcher, event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			s.Logger.WarnContext(ctx, "fs watcher err, resyncing index", slog.String("err", err.Error()))
+			s.resyncIndex(ctx)
+		case <-ticker.C:
+			s.resyncIndex(ctx)
+		case <-ctx.Done():
+			s.Logger.Info("fs index update stopped")
+			return
+		}
+	}
+}
+
+// indexEvent - applies an event of a watched dir. Files of wrong places and temp files are skipped
+func (s *Storage) indexEvent(ctx context.Context, watcher *fsnotify.Watcher, event fsnotify.Event) {
+	rel, err := filepath.Rel(s.Dir, filepath.Dir(event.Name))
+	if err != nil {
+		return
+	}
+
+	if rel == "." {
+		rel = ""
+	}
+
+	name := filepath.Base(event.Name)
+	if IsTemp(name) || rel == "" && name == LockDir {
+		return
+	}
+
+	s.index.event()
+	isShardDir := rel == "" && s.Layout.Depth() > 0
+
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			// it's already removed or renamed, a next event is applied
+			return
+		}
+
+		if !info.IsDir() {
+			if rel == s.Layout.Shard(name) {
+				s.index.Add(name)
+				s.changed(name)
+			}
+
+			return
+		}
+
+		if isShardDir {
+			s.watchShard(ctx, watcher, name)
+		}
+	case event.Has(fsnotify.Write):
+		// a file is rewritten in place
+		if rel == s.Layout.Shard(name) {
+			s.changed(name)
+		}
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		if rel == s.Layout.Shard(name) {
+			s.index.Remove(name)
+			s.changed(name)
+			return
+		}
+
+		if isShardDir {
+			// a dir is moved or removed with its files
+			s.resyncIndex(ctx)
+		}
+	}
+}
+
+// watchShard - watches a new shard dir, files, which are created before a watch, are added by a scan
+func (s *Storage) watchShard(ctx context.Context, watcher *fsnotify.Watcher, shard string) {
+	dir := filepath.Join(s.Dir, shard)
+	err := watcher.Add(dir)
+	if err == nil {
+		err = readDir(dir, func(entry os.DirEntry) error {
+			if !entry.IsDir() && !IsTemp(entry.Name()) && s.Layout.Shard(entry.Name()) == shard {
+				s.index.Add(entry.Name())
+				s.changed(entry.Name())
+			}
+
+			return nil
+		})
+	}
+
+	if err != nil {
+		s.Logger.WarnContext(ctx, "fs watcher err, resyncing index", slog.String("dir", shard), slog.String("err", err.Error()))
+		s.resyncIndex(ctx)
+	}
+}
+
+// resyncIndex - replaces an index by files of a dir, logs a freshness of a previous index.
+// Puts and deletes during a scan are kept, names, which were missed by events, are reported as changed
+func (s *Storage) resyncIndex(ctx context.Context) {
+	start := time.Now()
+	s.index.StartScan()
+	files, err := s.listDir(ctx)
+	if err != nil {
+		s.index.StopScan()
+		s.Logger.ErrorContext(ctx, "fs index resync err", slog.String("err", err.Error()))
+		return
+	}
+
+	age, events := s.index.Age()
+	added, removed := s.index.Replace(files)
+	level := slog.LevelInfo
+	if len(added) > 0 || len(removed) > 0 {
+		// events were missed, like writes of other hosts
+		level = slog.LevelWarn
+	}
+
+	for _, name := range slices.Concat(added, removed) {
+		s.changed(name)
+	}
+
+	s.Logger.Log(ctx, level, "fs index resynced",
+		slog.Int("files", len(files)),
+		slog.Int("missed_added", len(added)),
+		slog.Int("missed_removed", len(removed)),
+		slog.Int("events", events),
+		slog.Duration("age", age),
+		slog.Duration("took", time.Since(start)),
+	)
+}
@@ -0,0 +1,208 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// changes - names reported by OnChange
+type changes struct {
+	mut   sync.Mutex
+	names []string
+}
+
+func (c *changes) add(filename string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.names = append(c.names, filename)
+}
+
+func (c *changes) reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.names = nil
+}
+
+func (c *changes) has(filename string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return slices.Contains(c.names, filename)
+}
+
+// eventually - file system events are delivered asynchronously
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: timed out", what)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func listed(t *testing.T, s *Storage, filename string) bool {
+	t.Helper()
+
+	files, err := s.List(context.Background())
+	if err != nil {
+		t.Fatalf("list err: %v", err)
+	}
+
+	return slices.Contains(files, filename)
+}
+
+func TestFileIndexChangesDuringScan(t *testing.T) {
+	idx := newFileIndex([]string{"a-1.0-1.rockspec", "b-1.0-1.rockspec"})
+
+	idx.StartScan()
+	// a scan has read a dir, then a file is added and other one is removed by a storage
+	scanned := []string{"a-1.0-1.rockspec", "b-1.0-1.rockspec", "missed-1.0-1.rockspec"}
+	idx.Add("c-1.0-1.rockspec")
+	idx.Remove("a-1.0-1.rockspec")
+
+	added, removed := idx.Replace(scanned)
+	if want := []string{"b-1.0-1.rockspec", "c-1.0-1.rockspec", "missed-1.0-1.rockspec"}; !slices.Equal(idx.Keys(), want) {
+		t.Errorf("got %q, want %q", idx.Keys(), want)
+	}
+
+	if !slices.Equal(added, []string{"missed-1.0-1.rockspec"}) || len(removed) != 0 {
+		t.Errorf("got added %q and removed %q, want a missed file only", added, removed)
+	}
+
+	// changes of a failed scan are not kept for a next one
+	idx.StartScan()
+	idx.Remove("c-1.0-1.rockspec")
+	idx.StopScan()
+	added, removed = idx.Replace([]string{"b-1.0-1.rockspec", "c-1.0-1.rockspec"})
+	if !slices.Equal(idx.Keys(), []string{"b-1.0-1.rockspec", "c-1.0-1.rockspec"}) {
+		t.Errorf("got %q after a scan", idx.Keys())
+	}
+
+	if !slices.Equal(added, []string{"c-1.0-1.rockspec"}) || !slices.Equal(removed, []string{"missed-1.0-1.rockspec"}) {
+		t.Errorf("got added %q and removed %q", added, removed)
+	}
+}
+
+// TestWatchOutOfBandChanges - files, which are dropped into a dir or removed not by a storage, are indexed by events
+func TestWatchOutOfBandChanges(t *testing.T) {
+	for _, layout := range []Layout{LayoutFlat, LayoutName} {
+		t.Run(string(layout), func(t *testing.T) {
+			s, err := NewStorage(WithStorageConfig(&StorageConfig{Dir: t.TempDir(), Logger: testLogger, Layout: layout}))
+			if err != nil {
+				t.Fatalf("storage err: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err = s.Watch(ctx, time.Hour); err != nil {
+				t.Fatalf("watch err: %v", err)
+			}
+
+			var c changes
+			s.OnChange(ctx, c.add)
+
+			const filename = "foo-1.0-1.rockspec"
+			fpath := s.path(filename)
+			if err = os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = os.WriteFile(fpath, []byte("content"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			eventually(t, "dropped file", func() bool { return listed(t, s, filename) && c.has(filename) })
+
+			// a temp file is not indexed
+			if err = os.WriteFile(filepath.Join(filepath.Dir(fpath), TempPrefix+"bar"), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c.reset()
+			if err = os.Remove(fpath); err != nil {
+				t.Fatal(err)
+			}
+
+			eventually(t, "removed file", func() bool { return !listed(t, s, filename) && c.has(filename) })
+			if files, _ := s.List(ctx); len(files) != 0 {
+				t.Errorf("got %q, want no files", files)
+			}
+		})
+	}
+}
+
+// TestResyncMissedChanges - a resync finds changes, events of which are missed, like writes of other hosts
+func TestResyncMissedChanges(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	ctx := context.Background()
+	if err := s.Put(ctx, "foo-1.0-1.rockspec", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	// an index without a watcher, so no events are delivered
+	files, err := s.listDir(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.index = newFileIndex(files)
+	var c changes
+	s.OnChange(ctx, c.add)
+
+	if err = os.WriteFile(s.path("bar-1.0-1.rockspec"), []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Remove(s.path("foo-1.0-1.rockspec")); err != nil {
+		t.Fatal(err)
+	}
+
+	if listed(t, s, "bar-1.0-1.rockspec") || !listed(t, s, "foo-1.0-1.rockspec") {
+		t.Fatal("an index is changed without events")
+	}
+
+	s.resyncIndex(ctx)
+	if !listed(t, s, "bar-1.0-1.rockspec") || listed(t, s, "foo-1.0-1.rockspec") {
+		t.Errorf("got %q after a resync", s.index.Keys())
+	}
+
+	if !c.has("bar-1.0-1.rockspec") || !c.has("foo-1.0-1.rockspec") {
+		t.Errorf("got changes %q, want both files", c.names)
+	}
+}
+
+// TestOnChangeRemoved - callbacks are removed, when their ctx is done
+func TestOnChangeRemoved(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var kept, removed changes
+	s.OnChange(context.Background(), kept.add)
+	s.OnChange(ctx, removed.add)
+	cancel()
+
+	eventually(t, "callback removal", func() bool {
+		s.changeMut.RLock()
+		defer s.changeMut.RUnlock()
+
+		return len(s.onChange) == 1
+	})
+
+	s.changed("foo-1.0-1.rockspec")
+	if !kept.has("foo-1.0-1.rockspec") || removed.has("foo-1.0-1.rockspec") {
+		t.Errorf("got kept %q and removed %q", kept.names, removed.names)
+	}
+}
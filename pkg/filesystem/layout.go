@@ -0,0 +1,95 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// LayoutFlat - all files are in a storage dir
+	LayoutFlat Layout = "flat"
+	// LayoutName - files are in dirs of rock names: <dir>/lua-cjson/lua-cjson-2.1.0-1.rockspec
+	LayoutName Layout = "name"
+	// LayoutHash - files are in dirs of a hash of rock names: <dir>/3f/lua-cjson-2.1.0-1.rockspec,
+	// a number of dirs does not exceed 256
+	LayoutHash Layout = "hash"
+
+	// otherShard - a dir of files, which are not named like rocks or rockspecs
+	otherShard = "_"
+)
+
+// Layout - places files of a storage dir. Storage exposes flat file names with any layout
+type Layout string
+
+func ParseLayout(s string) (Layout, error) {
+	switch l := Layout(s); l {
+	case "":
+		return LayoutFlat, nil
+	case LayoutFlat, LayoutName, LayoutHash:
+		return l, nil
+	}
+
+	return "", fmt.Errorf("unsupported layout %q, supported are %s, %s, %s", s, LayoutFlat, LayoutName, LayoutHash)
+}
+
+// Shard - a dir of a file relative to a storage dir, it's empty for the flat layout
+func (l Layout) Shard(filename string) string {
+	switch l {
+	case LayoutName:
+		return rockName(filename)
+	case LayoutHash:
+		sum := sha256.Sum256([]byte(rockName(filename)))
+		return hex.EncodeToString(sum[:1])
+	}
+
+	return ""
+}
+
+// Path - a path of a file relative to a storage dir
+func (l Layout) Path(filename string) string {
+	return path.Join(l.Shard(filename), filename)
+}
+
+// Depth - a number of dirs between a storage dir and files
+func (l Layout) Depth() int {
+	if l == LayoutName || l == LayoutHash {
+		return 1
+	}
+
+	return 0
+}
+
+// rockName - a name of name-version-revision.arch.rock or name-version-revision.rockspec.
+// Names, which may clash with service dirs, and other files go to a common dir
+func rockName(filename string) string {
+	base, ok := strings.CutSuffix(filename, ".rockspec")
+	if !ok {
+		if base, ok = strings.CutSuffix(filename, ".rock"); !ok {
+			return otherShard
+		}
+
+		// arch
+		if i := strings.LastIndexByte(base, '.'); i > 0 {
+			base = base[:i]
+		}
+	}
+
+	// revision and version
+	for n := 0; n < 2; n++ {
+		i := strings.LastIndexByte(base, '-')
+		if i <= 0 {
+			return otherShard
+		}
+
+		base = base[:i]
+	}
+
+	if base == "" || strings.HasPrefix(base, ".") {
+		return otherShard
+	}
+
+	return base
+}
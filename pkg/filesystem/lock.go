@@ -0,0 +1,113 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// LockDir - a directory of lock files, List skips directories, so lock files are not listed
+	LockDir = ".mountain-locks"
+
+	lockRetryMin = time.Millisecond * 5
+	lockRetryMax = time.Millisecond * 200
+)
+
+type (
+	// objectLocks - in-process locks by file name, goroutines of one process do not hit a lock file
+	objectLocks struct {
+		mut   sync.Mutex
+		locks map[string]*objectLock
+	}
+
+	// objectLock - a semaphore of a single slot, so waiting for it is cancelled by ctx
+	objectLock struct {
+		sem  chan struct{}
+		refs int
+	}
+)
+
+func newObjectLocks() *objectLocks {
+	return &objectLocks{locks: make(map[string]*objectLock)}
+}
+
+func (l *objectLocks) acquire(name string) *objectLock {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = &objectLock{sem: make(chan struct{}, 1)}
+		l.locks[name] = lock
+	}
+
+	lock.refs++
+	return lock
+}
+
+func (l *objectLocks) release(name string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if lock := l.locks[name]; lock != nil {
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, name)
+		}
+	}
+}
+
+// lock - locks a file exclusively in process and across processes by an advisory lock of a lock file,
+// waiting is cancelled by ctx. Writers and deletes are serialized, readers do not lock: an opened file
+// is not changed by a rename or a removal of its name. A returned unlock must be called
+func (s *Storage) lock(ctx context.Context, filename string) (func(), error) {
+	lock := s.locks.acquire(filename)
+	select {
+	case lock.sem <- struct{}{}:
+	case <-ctx.Done():
+		s.locks.release(filename)
+		return nil, fmt.Errorf("lock %s err: %w", filename, ctx.Err())
+	}
+
+	unlockProcess := func() {
+		<-lock.sem
+		s.locks.release(filename)
+	}
+
+	// lock files are never removed: a removal races with other processes, which opened the same file
+	file, err := os.OpenFile(path.Join(s.Dir, LockDir, filename+".lock"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		unlockProcess()
+		return nil, fmt.Errorf("lock file open err: %w", err)
+	}
+
+	for delay := lockRetryMin; ; delay = min(delay*2, lockRetryMax) {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			unlockProcess()
+			return nil, fmt.Errorf("lock %s err: %w", filename, err)
+		}
+
+		if locked {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			unlockProcess()
+			return nil, fmt.Errorf("lock %s err: %w", filename, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+
+	return func() {
+		unlockFile(file)
+		file.Close()
+		unlockProcess()
+	}, nil
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLockAcrossStorages - storages of a same dir, like storages of different processes, wait for
+// a lock file, a wait is cancelled by ctx
+func TestLockAcrossStorages(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newTestStorage(t, dir), newTestStorage(t, dir)
+
+	unlock, err := first.lock(context.Background(), "foo-1.0-1.rockspec")
+	if err != nil {
+		t.Fatalf("lock err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	if err = second.Create(ctx, "foo-1.0-1.rockspec", strings.NewReader("content")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("create: got %v, want context.DeadlineExceeded", err)
+	}
+
+	checkNoLocks(t, second)
+	done := make(chan error, 1)
+	go func() {
+		done <- second.Create(context.Background(), "foo-1.0-1.rockspec", strings.NewReader("content"))
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	unlock()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("create after unlock err: %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("a lock file is not released by unlock")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package filesystem
+
+import (
+	"os"
+)
+
+// tryLockFile - advisory locks are not supported, only in-process locks are used
+func tryLockFile(*os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(*os.File) {}
@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+)
+
+const (
+	// maxLayoutDepth - the deepest layout, files of any layout are found up to this depth
+	maxLayoutDepth = 1
+)
+
+type (
+	MigrateResult struct {
+		// Moved - files, which are moved to places of a layout
+		Moved int
+		// Conflicts - files, which are not moved, because a file with the same name is already in place
+		Conflicts []string
+	}
+
+	move struct {
+		from, filename string
+	}
+)
+
+// Migrate - moves files of any layout to places of a storage layout, empty shard dirs are removed.
+// It's made for stopped servers: files are locked one by one, but running servers do not see moved files,
+// until a layout of their config is changed. In a dry run files are only counted
+func (s *Storage) Migrate(ctx context.Context, dryRun bool) (*MigrateResult, error) {
+	var moves []move
+	err := walkFiles(s.Dir, maxLayoutDepth, func(rel string, entry os.DirEntry) error {
+		if IsTemp(entry.Name()) || rel == s.Layout.Shard(entry.Name()) {
+			return nil
+		}
+
+		moves = append(moves, move{from: path.Join(rel, entry.Name()), filename: entry.Name()})
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("storage dir read err: %w", err)
+	}
+
+	result := &MigrateResult{}
+	for _, m := range moves {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		moved, err := s.migrateFile(ctx, m, dryRun)
+		if err != nil {
+			return result, fmt.Errorf("file %s migrate err: %w", m.from, err)
+		}
+
+		if !moved {
+			result.Conflicts = append(result.Conflicts, m.from)
+			continue
+		}
+
+		result.Moved++
+	}
+
+	if !dryRun {
+		s.removeEmptyShards()
+	}
+
+	return result, nil
+}
+
+// migrateFile - moves a file, false means, that a file of a target place exists and a file is left
+func (s *Storage) migrateFile(ctx context.Context, m move, dryRun bool) (bool, error) {
+	to := s.path(m.filename)
+	if dryRun {
+		_, err := os.Stat(to)
+		return errors.Is(err, os.ErrNotExist), nil
+	}
+
+	unlock, err := s.lock(ctx, m.filename)
+	if err != nil {
+		return false, err
+	}
+
+	defer unlock()
+
+	if err = CreateDirIfNotExists(path.Dir(to)); err != nil {
+		return false, err
+	}
+
+	from := path.Join(s.Dir, m.from)
+	if err = s.link(ctx, from, to); errors.Is(err, os.ErrExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err = os.Remove(from); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	s.Logger.DebugContext(ctx, "file moved", slog.String("from", m.from), slog.String("to", s.Layout.Path(m.filename)))
+	return true, nil
+}
+
+func (s *Storage) removeEmptyShards() {
+	err := readDir(s.Dir, func(entry os.DirEntry) error {
+		if entry.IsDir() && entry.Name() != LockDir {
+			// only empty dirs are removed
+			_ = os.Remove(path.Join(s.Dir, entry.Name()))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.Logger.Warn("unable to remove empty shard dirs", slog.String("err", err.Error()))
+	}
+
+	if err = syncDir(s.Dir); err != nil {
+		s.Logger.Warn("dir sync err", slog.String("err", err.Error()))
+	}
+}
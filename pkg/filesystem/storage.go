@@ -2,12 +2,24 @@ package filesystem
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"lua-mountain/pkg/option"
+	"lua-mountain/pkg/storage"
 	"os"
 	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// TempPrefix - files are written to temp files with this prefix and renamed into place, when they are complete
+	TempPrefix = ".mountain-tmp-"
+	// DefaultStaleTempAge - temp files older than that are left by crashed or killed uploads
+	DefaultStaleTempAge = time.Hour
 )
 
 type (
@@ -15,13 +27,27 @@ type (
 	StorageConfig struct {
 		Dir string
 		Logger *slog.Logger
+		// StaleTempAge - temp files older than that are removed on start, DefaultStaleTempAge by default
+		StaleTempAge time.Duration
+		// Layout - LayoutFlat by default, a changed layout requires Migrate
+		Layout Layout
 	}
 
 
-	// TODO: lock system for preventing deleting/rewriting object
+	// Storage - files of a directory, placed by a layout. Writes and deletes lock a file,
+	// locks work across processes, which share a directory
 	Storage struct {
 		Dir string
 		Logger *slog.Logger
+		StaleTempAge time.Duration
+		Layout Layout
+		locks *objectLocks
+		// index - files, which are read by List and Exists, when a storage is watched
+		index *fileIndex
+		// changeMut - guards onChange, callbacks are added by repositories, which share a storage
+		changeMut    sync.RWMutex
+		onChange     map[uint64]func(filename string)
+		nextCallback uint64
 	}
 )
 
@@ -36,12 +62,14 @@ func WithStorageConfig(cfg *StorageConfig) option.ErrOption[*Storage] {
 	return func(s *Storage) error {
 		s.Dir = cfg.Dir
 		s.Logger = cfg.Logger
+		s.StaleTempAge = cfg.StaleTempAge
+		s.Layout = cfg.Layout
 		return nil
 	}
 }
 
 func NewStorage(opts ...option.ErrOption[*Storage]) (s *Storage, err error) {
-	s = &Storage{}
+	s = &Storage{locks: newObjectLocks()}
 	for _, opt := range opts {
 		if err = opt(s); err != nil {
 			return
@@ -56,24 +84,47 @@ func NewStorage(opts ...option.ErrOption[*Storage]) (s *Storage, err error) {
 		return nil, errors.New("empty dir is not allowed")
 	}
 
+	if s.StaleTempAge == 0 {
+		s.StaleTempAge = DefaultStaleTempAge
+	}
+
+	if s.Layout, err = ParseLayout(string(s.Layout)); err != nil {
+		return nil, err
+	}
+
 	if err = CreateDirIfNotExists(s.Dir); err != nil {
 		return
 	}
 
+	if err = CreateDirIfNotExists(path.Join(s.Dir, LockDir)); err != nil {
+		return
+	}
+
+	s.RemoveStaleTemps(time.Now().Add(-s.StaleTempAge))
 	return
 }
 
+// path - a path of a file by a layout
+func (s *Storage) path(filename string) string {
+	return path.Join(s.Dir, s.Layout.Path(filename))
+}
+
 func (s *Storage) Get(ctx context.Context, filename string) (io.ReadCloser, error) {
-	fpath := path.Join(s.Dir, filename)
+	fpath := s.path(filename)
 	s.Logger.DebugContext(ctx, "filesystem.Storage:Get() / os.Open()",
 		slog.String("filepath", fpath),
 	)
 
+	// a reader is not locked: Put and Delete replace or remove a name, an opened file is kept
 	return os.Open(fpath)
 }
 
 func (s *Storage) Exists(ctx context.Context, filename string) error {
-	filepath := path.Join(s.Dir, filename)
+	if s.index != nil && s.index.Has(filename) {
+		return nil
+	}
+
+	filepath := s.path(filename)
 	_, err := os.Stat(filepath)
 	s.Logger.DebugContext(ctx, "filesystem.Storage:Exists()",
 		slog.String("filepath", filepath),
@@ -83,65 +134,290 @@ func (s *Storage) Exists(ctx context.Context, filename string) error {
 		return err
 	}
 
+	// a file is written by other host, events of which are not delivered
+	if s.index != nil {
+		s.index.Add(filename)
+	}
+
 	return nil
 }
 
+// Put - writes a file to a temp file, syncs and renames it into place, so readers never see a partial file.
+// A content is checked by storage.Expectation of ctx before a rename
 func (s *Storage) Put(ctx context.Context, filename string, r io.Reader) error {
-	fpath := path.Join(s.Dir, filename)
-	s.Logger.DebugContext(ctx, "filesystem.Storage:Put() / os.Create()",
-		slog.String("filepath", fpath),
-	)
+	tmp, err := s.writeTemp(ctx, filename, r)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp)
 
-	file, err := os.Create(fpath)
+	unlock, err := s.lock(ctx, filename)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
+	defer unlock()
 
-	s.Logger.DebugContext(ctx, "filesystem.Storage:Put() / io.Copy()",
-		slog.String("filepath", fpath),
-	)
+	if err = os.Rename(tmp, s.path(filename)); err != nil {
+		return err
+	}
+
+	s.indexAdd(filename)
+	s.syncDir(ctx, path.Dir(tmp))
+	return nil
+}
 
-	if _, err = io.Copy(file, r); err != nil {
+// Create - like Put, but a file is stored only if it is absent, otherwise an error wraps os.ErrExist.
+// A check and a creation are atomic: a temp file is hard linked to a file name
+func (s *Storage) Create(ctx context.Context, filename string, r io.Reader) error {
+	tmp, err := s.writeTemp(ctx, filename, r)
+	if err != nil {
 		return err
 	}
 
+	defer os.Remove(tmp)
+
+	unlock, err := s.lock(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if err = s.link(ctx, tmp, s.path(filename)); err != nil {
+		return fmt.Errorf("file %s: %w", filename, err)
+	}
+
+	s.indexAdd(filename)
+	s.syncDir(ctx, path.Dir(tmp))
 	return nil
 }
 
+// link - hard links a file to a new name, which must be absent, otherwise an error wraps os.ErrExist.
+// A caller must hold an exclusive lock of a file and remove an old name, it may be already moved
+func (s *Storage) link(ctx context.Context, oldpath, newpath string) error {
+	err := os.Link(oldpath, newpath)
+	if errors.Is(err, os.ErrExist) {
+		return os.ErrExist
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	// some file systems have no hard links, a check under an exclusive lock is used then
+	s.Logger.DebugContext(ctx, "hard link err, falling back to rename", slog.String("err", err.Error()))
+	if _, err = os.Stat(newpath); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return os.Rename(oldpath, newpath)
+}
+
+// writeTemp - writes a complete and synced temp file near a target one, returns its path
+func (s *Storage) writeTemp(ctx context.Context, filename string, r io.Reader) (tmp string, err error) {
+	s.Logger.DebugContext(ctx, "filesystem.Storage:Put() / os.CreateTemp()",
+		slog.String("filepath", s.path(filename)),
+	)
+
+	// shard dirs are not removed, so a dir is not removed between its creation and a rename
+	dir := path.Join(s.Dir, s.Layout.Shard(filename))
+	if err = CreateDirIfNotExists(dir); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, TempPrefix+filename+".*")
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	s.Logger.DebugContext(ctx, "filesystem.Storage:Put() / io.Copy()",
+		slog.String("temp", file.Name()),
+	)
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		return "", err
+	}
+
+	if exp, ok := storage.ExpectationFrom(ctx); ok {
+		if err = exp.Check(size, hash.Sum(nil)); err != nil {
+			return "", fmt.Errorf("file %s: %w", filename, err)
+		}
+	}
+
+	// CreateTemp makes files readable by an owner only
+	if err = file.Chmod(0o644); err != nil {
+		return "", err
+	}
+
+	if err = file.Sync(); err != nil {
+		return "", err
+	}
+
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// indexAdd - a written file is listed at once, a file system event may come later
+func (s *Storage) indexAdd(filename string) {
+	if s.index != nil {
+		s.index.Add(filename)
+	}
+}
+
+// OnChange - adds a callback of files, which are changed out of a storage, a callback is removed, when ctx is done.
+// Changes are found by file system events and resyncs of a watched index, a storage without an index reports nothing
+func (s *Storage) OnChange(ctx context.Context, fn func(filename string)) {
+	s.changeMut.Lock()
+	defer s.changeMut.Unlock()
+
+	if s.onChange == nil {
+		s.onChange = make(map[uint64]func(filename string))
+	}
+
+	id := s.nextCallback
+	s.nextCallback++
+	s.onChange[id] = fn
+	context.AfterFunc(ctx, func() {
+		s.changeMut.Lock()
+		defer s.changeMut.Unlock()
+
+		delete(s.onChange, id)
+	})
+}
+
+// changed - reports a changed file to callbacks
+func (s *Storage) changed(filename string) {
+	s.changeMut.RLock()
+	defer s.changeMut.RUnlock()
+
+	for _, fn := range s.onChange {
+		fn(filename)
+	}
+}
+
+// syncDir - a rename is durable after a sync of a directory
+func (s *Storage) syncDir(ctx context.Context, dir string) {
+	if err := syncDir(dir); err != nil {
+		s.Logger.WarnContext(ctx, "dir sync err", slog.String("err", err.Error()))
+	}
+}
+
+// RemoveStaleTemps - removes temp files of uploads, which were interrupted before olderThan
+func (s *Storage) RemoveStaleTemps(olderThan time.Time) {
+	err := walkFiles(s.Dir, s.Layout.Depth(), func(rel string, entry os.DirEntry) error {
+		if !IsTemp(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(olderThan) {
+			return nil
+		}
+
+		name := path.Join(rel, entry.Name())
+		if err = os.Remove(path.Join(s.Dir, name)); err != nil {
+			s.Logger.Warn("unable to remove stale temp file",
+				slog.String("file", name),
+				slog.String("err", err.Error()),
+			)
+			return nil
+		}
+
+		s.Logger.Info("stale temp file removed", slog.String("file", name))
+		return nil
+	})
+
+	if err != nil {
+		s.Logger.Warn("unable to read dir for stale temp files", slog.String("err", err.Error()))
+	}
+}
+
 func (s *Storage) Delete(ctx context.Context, filename string) error {
-	fpath := path.Join(s.Dir, filename)
+	fpath := s.path(filename)
 	s.Logger.DebugContext(ctx, "filesystem.Storage:Delete() / os.Remove()",
 		slog.String("filepath", fpath),
 	)
 
-	return os.Remove(fpath)
+	unlock, err := s.lock(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	err = os.Remove(fpath)
+	if s.index != nil && (err == nil || errors.Is(err, os.ErrNotExist)) {
+		s.index.Remove(filename)
+	}
+
+	return err
 }
 
+// List - names of files, which are placed by a layout. Other files are skipped, see Migrate.
+// Names are read from an index, when a storage is watched
 func (s *Storage) List(ctx context.Context) ([]string, error) {
+	if s.index != nil {
+		age, events := s.index.Age()
+		s.Logger.DebugContext(ctx, "reading an index",
+			slog.Duration("resynced_ago", age),
+			slog.Int("events", events),
+		)
+
+		return s.index.Keys(), nil
+	}
+
+	return s.listDir(ctx)
+}
+
+func (s *Storage) listDir(ctx context.Context) ([]string, error) {
 	s.Logger.DebugContext(ctx, "reading a dir",
 		slog.String("dir", s.Dir),
 	)
 
-	// TODO: read dir by batches
-	entries, err := os.ReadDir(s.Dir)
+	var (
+		files []string
+		misplaced int
+	)
+
+	err := walkFiles(s.Dir, s.Layout.Depth(), func(rel string, entry os.DirEntry) error {
+		if IsTemp(entry.Name()) {
+			return nil
+		}
+
+		if rel != s.Layout.Shard(entry.Name()) {
+			misplaced++
+			return nil
+		}
+
+		files = append(files, entry.Name())
+		return nil
+	})
+
 	if err != nil {
 		return nil, err
 	}
 
-	files := make([]string, 0, len(entries))
-	var entry os.DirEntry
-	for _, entry = range entries {
-		if entry.IsDir() {
-			s.Logger.DebugContext(ctx, "skip inner directory",
-				slog.String("dir", entry.Name()),
-			)
-			continue
-		}
-		files = append(files, entry.Name())
+	if misplaced > 0 {
+		s.Logger.WarnContext(ctx, "files do not match a storage layout and are skipped, migrate a storage",
+			slog.String("layout", string(s.Layout)),
+			slog.Int("files", misplaced),
+		)
 	}
 
 	return files, nil
 }
-
@@ -0,0 +1,216 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestStorage(t *testing.T, dir string) *Storage {
+	t.Helper()
+
+	s, err := NewStorage(WithStorageConfig(&StorageConfig{Dir: dir, Logger: testLogger}))
+	if err != nil {
+		t.Fatalf("storage err: %v", err)
+	}
+
+	return s
+}
+
+func readFile(t *testing.T, s *Storage, filename string) string {
+	t.Helper()
+
+	f, err := s.Get(context.Background(), filename)
+	if err != nil {
+		t.Fatalf("get %s err: %v", filename, err)
+	}
+
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s err: %v", filename, err)
+	}
+
+	return string(content)
+}
+
+// checkNoTemps - writes must not leave temp files
+func checkNoTemps(t *testing.T, s *Storage) {
+	t.Helper()
+
+	err := walkFiles(s.Dir, s.Layout.Depth(), func(rel string, entry os.DirEntry) error {
+		if IsTemp(entry.Name()) {
+			t.Errorf("temp file %s is left", entry.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkNoLocks - in-process locks are released by all callers, including cancelled ones
+func checkNoLocks(t *testing.T, s *Storage) {
+	t.Helper()
+
+	s.locks.mut.Lock()
+	defer s.locks.mut.Unlock()
+
+	if len(s.locks.locks) != 0 {
+		t.Errorf("got %d in-process locks, want 0", len(s.locks.locks))
+	}
+}
+
+// TestStorageCreateConcurrent - only one of concurrent creates of a same name stores a file
+func TestStorageCreateConcurrent(t *testing.T) {
+	const writers = 16
+
+	s := newTestStorage(t, t.TempDir())
+	ctx := context.Background()
+	errs := make([]error, writers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Create(ctx, "foo-1.0-1.rockspec", strings.NewReader(fmt.Sprintf("writer %d", i)))
+		}(i)
+	}
+
+	wg.Wait()
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil && winner < 0:
+			winner = i
+		case err == nil:
+			t.Errorf("writers %d and %d both created a file", winner, i)
+		case !errors.Is(err, os.ErrExist):
+			t.Errorf("writer %d: got %v, want os.ErrExist", i, err)
+		}
+	}
+
+	if winner < 0 {
+		t.Fatal("no writer created a file")
+	}
+
+	if got, want := readFile(t, s, "foo-1.0-1.rockspec"), fmt.Sprintf("writer %d", winner); got != want {
+		t.Errorf("got %q, want %q of a winner", got, want)
+	}
+
+	checkNoTemps(t, s)
+	checkNoLocks(t, s)
+}
+
+// TestStoragePutDeleteConcurrent - puts and deletes of storages, which share a dir, are serialized:
+// a file is either absent or one of complete contents
+func TestStoragePutDeleteConcurrent(t *testing.T) {
+	const (
+		workers = 8
+		rounds  = 20
+	)
+
+	dir := t.TempDir()
+	storages := []*Storage{newTestStorage(t, dir), newTestStorage(t, dir)}
+	ctx := context.Background()
+	content := func(i int) string {
+		return fmt.Sprintf("worker %d ", i) + strings.Repeat("x", 4096*i)
+	}
+
+	contents := make(map[string]bool, workers)
+	for i := 0; i < workers; i++ {
+		contents[content(i)] = true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			s := storages[i%len(storages)]
+			for j := 0; j < rounds; j++ {
+				if err := s.Put(ctx, "foo-1.0-1.rockspec", strings.NewReader(content(i))); err != nil {
+					t.Errorf("worker %d: put err: %v", i, err)
+					return
+				}
+
+				if j%2 == 0 {
+					continue
+				}
+
+				if err := s.Delete(ctx, "foo-1.0-1.rockspec"); err != nil && !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("worker %d: delete err: %v", i, err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	if err := storages[0].Exists(ctx, "foo-1.0-1.rockspec"); err == nil {
+		if got := readFile(t, storages[0], "foo-1.0-1.rockspec"); !contents[got] {
+			t.Errorf("got a mixed or partial content of %d bytes", len(got))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("exists err: %v", err)
+	}
+
+	checkNoTemps(t, storages[0])
+	for _, s := range storages {
+		checkNoLocks(t, s)
+	}
+}
+
+// TestStorageLockCancel - a write, which waits for a lock, fails by its ctx and leaves nothing
+func TestStorageLockCancel(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	unlock, err := s.lock(context.Background(), "foo-1.0-1.rockspec")
+	if err != nil {
+		t.Fatalf("lock err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	err = s.Put(ctx, "foo-1.0-1.rockspec", strings.NewReader("content"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("put: got %v, want context.DeadlineExceeded", err)
+	}
+
+	if err = s.Exists(context.Background(), "foo-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cancelled put stored a file: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	deleted := make(chan error, 1)
+	go func() {
+		deleted <- s.Delete(cancelled, "foo-1.0-1.rockspec")
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+	if err = <-deleted; !errors.Is(err, context.Canceled) {
+		t.Errorf("delete: got %v, want context.Canceled", err)
+	}
+
+	unlock()
+	checkNoTemps(t, s)
+	checkNoLocks(t, s)
+
+	// a released lock is taken by a next write
+	if err = s.Put(context.Background(), "foo-1.0-1.rockspec", strings.NewReader("content")); err != nil {
+		t.Errorf("put after unlock err: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package mountain - embedding of a rocks server into other services:
+//
+//	srv, err := mountain.New(ctx, &mountain.Config{
+//		Repositories: []mountain.RepositoryConfig{{Prefix: "/rocks", Storage: "rocks"}},
+//		Storages:     map[string]storage.Storage{"rocks": st},
+//	}, mountain.WithLogger(logger))
+//
+//	mux.Handle("/rocks/", srv)
+package mountain
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/maps"
+
+	"lua-mountain/internal/mountain/auth"
+	"lua-mountain/internal/mountain/repository"
+	"lua-mountain/internal/mountain/server"
+	"lua-mountain/internal/mountain/server/mw"
+	"lua-mountain/pkg/option"
+	"lua-mountain/pkg/storage"
+)
+
+type (
+	Config struct {
+		Repositories []RepositoryConfig
+		// Storages - storages by name, RepositoryConfig.Storage refers them
+		Storages map[string]storage.Storage
+		// Auth - built-in authenticators: api tokens, jwt and client certificates
+		Auth AuthConfig
+	}
+
+	// Server - routes of repositories and of luarocks upload api
+	Server struct {
+		handler        http.Handler
+		logger         *slog.Logger
+		middleware     []func(http.Handler) http.Handler
+		authenticators auth.Chain
+	}
+)
+
+// WithLogger - slog.Default() is used by default
+func WithLogger(logger *slog.Logger) option.ErrOption[*Server] {
+	return func(s *Server) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// WithMiddleware - wraps routes, the first middleware is the outermost one
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) option.ErrOption[*Server] {
+	return func(s *Server) error {
+		s.middleware = append(s.middleware, middleware...)
+		return nil
+	}
+}
+
+// WithAuthenticator - adds an auth hook, hooks are tried before built-in authenticators of Config.Auth.
+// A hook returns ErrNoCredentials for requests, which it does not recognize
+func WithAuthenticator(authenticator Authenticator) option.ErrOption[*Server] {
+	return func(s *Server) error {
+		s.authenticators = append(s.authenticators, authenticator)
+		return nil
+	}
+}
+
+// New - creates repositories of a config and registers their routes,
+// background goroutines of repositories and authenticators are stopped, when ctx is done
+func New(ctx context.Context, cfg *Config, opts ...option.ErrOption[*Server]) (*Server, error) {
+	s := &Server{}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+
+	// api keys of the upload api are a part of paths
+	srv := server.Init(s.logger, repository.RedactAPIKey)
+	authenticator, err := s.authenticator(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make(map[string]*repository.Repository, len(cfg.Repositories))
+	for _, repoCfg := range cfg.Repositories {
+		if len(repoCfg.Members) > 0 {
+			continue
+		}
+
+		st, ok := cfg.Storages[repoCfg.Storage]
+		if !ok {
+			s.logger.Warn("unable to find repository storage",
+				slog.String("repository", repoCfg.Prefix),
+				slog.String("storage", repoCfg.Storage),
+			)
+			continue
+		}
+
+		repo, err := repository.New(ctx, &repoCfg, st, s.logger)
+		if err != nil {
+			s.logger.Warn("unable to create repository",
+				slog.String("repository", repoCfg.Prefix),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		repoAuth, err := s.repositoryAuth(ctx, &repoCfg, authenticator)
+		if err != nil {
+			s.logger.Warn("unable to init repository auth",
+				slog.String("repository", repoCfg.Prefix),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		repos[repoCfg.Prefix] = repo
+		s.registerRepository(srv, repo, repoAuth)
+	}
+
+	// groups are created after storage repositories, a group may refer to groups defined above it
+	for _, repoCfg := range cfg.Repositories {
+		if len(repoCfg.Members) == 0 {
+			continue
+		}
+
+		// a group without some members resolves files by other precedence and lists other rocks,
+		// so it is not served at all
+		members := make([]*repository.Repository, 0, len(repoCfg.Members))
+		for _, prefix := range repoCfg.Members {
+			member, ok := repos[prefix]
+			if !ok {
+				s.logger.Error("unable to find group member, group is not served",
+					slog.String("repository", repoCfg.Prefix),
+					slog.String("member", prefix),
+				)
+				break
+			}
+
+			members = append(members, member)
+		}
+
+		if len(members) < len(repoCfg.Members) {
+			continue
+		}
+
+		repo, err := repository.NewGroup(&repoCfg, members, s.logger)
+		if err != nil {
+			s.logger.Warn("unable to create repository",
+				slog.String("repository", repoCfg.Prefix),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		repoAuth, err := s.repositoryAuth(ctx, &repoCfg, authenticator)
+		if err != nil {
+			s.logger.Warn("unable to init repository auth",
+				slog.String("repository", repoCfg.Prefix),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		repos[repoCfg.Prefix] = repo
+		s.registerRepository(srv, repo, repoAuth)
+	}
+
+	uploadAPI, err := repository.NewUploadAPI(maps.Values(repos), s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if uploadAPI.Enabled() {
+		registerUploadAPI(srv, uploadAPI)
+	}
+
+	for _, r := range srv.Routes() {
+		if r.Method == "echo_route_not_found" {
+			continue
+		}
+
+		s.logger.Info("mountain`s route inited",
+			slog.String("method", r.Method),
+			slog.String("path", r.Path),
+		)
+	}
+
+	s.handler = srv
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		s.handler = s.middleware[i](s.handler)
+	}
+
+	return s, nil
+}
+
+// repositoryAuth - adds repository htpasswd users to global authenticators
+func (s *Server) repositoryAuth(ctx context.Context, cfg *repository.Config, global auth.Authenticator) (auth.Authenticator, error) {
+	if cfg.Htpasswd == nil {
+		return global, nil
+	}
+
+	htpasswd, err := auth.NewHtpasswd(ctx, cfg.Htpasswd, cfg.Prefix, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if global == nil {
+		return htpasswd, nil
+	}
+
+	return auth.Chain{global, htpasswd}, nil
+}
+
+// registerUploadAPI - luarocks upload client builds urls as <server>/api/<api version>/<key>/<method>
+func registerUploadAPI(srv *echo.Echo, api *repository.UploadAPI) {
+	srv.GET("/api/tool_version", api.ToolVersion)
+	aGroup := srv.Group("/api/" + repository.UploadAPIVersion + "/:key")
+	aGroup.GET("/status", api.Status)
+	aGroup.GET("/check_rockspec", api.CheckRockspec)
+	aGroup.POST("/upload", api.Upload)
+	aGroup.POST("/upload_rock/:id", api.UploadRock)
+}
+
+func (s *Server) registerRepository(srv *echo.Echo, repo *repository.Repository, authenticator auth.Authenticator) {
+	extMw := mw.AllowedExtensions(repo.AllowedFileExtensions)
+	access := func(op auth.Operation, scope []string) []echo.MiddlewareFunc {
+		if authenticator == nil {
+			return nil
+		}
+
+		return []echo.MiddlewareFunc{
+			mw.Auth(authenticator, scope, op, repo.AnonymousRead, s.logger),
+		}
+	}
+
+	rGroup := srv.Group(repo.Prefix)
+	// groups serve files of members, so members must be readable too
+	read := access(auth.OpRead, repo.ReadScope())
+	for _, man := range repo.ManifestNames() {
+		rGroup.GET("/"+man, repo.GetManifest, read...)
+		rGroup.GET("/"+man+".json", repo.GetManifestJson, read...)
+		rGroup.GET("/"+man+".zip", repo.GetManifestZip, read...)
+	}
+
+	rGroup.GET("/search/modules/:name", repo.SearchModule, read...)
+	rGroup.GET("/search/commands/:name", repo.SearchCommand, read...)
+	rGroup.GET("/:filename", repo.Get, append(read, extMw)...)
+	if repo.IsGroup() {
+		// groups are read only
+		return
+	}
+
+	own := []string{repo.Prefix}
+	rGroup.PUT("/:filename", repo.Put, append(access(auth.OpPut, own), extMw)...)
+	rGroup.DELETE("/:filename", repo.Delete, append(access(auth.OpDelete, own), extMw)...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// authenticator - hooks and built-in authenticators, nil means, that authentication is disabled
+func (s *Server) authenticator(ctx context.Context, cfg *Config) (auth.Authenticator, error) {
+	builtin, err := auth.New(ctx, &cfg.Auth, cfg.Storages, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.authenticators) == 0 {
+		return builtin, nil
+	}
+
+	chain := append(auth.Chain{}, s.authenticators...)
+	if builtin != nil {
+		chain = append(chain, builtin)
+	}
+
+	return chain, nil
+}
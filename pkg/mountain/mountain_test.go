@@ -0,0 +1,64 @@
+package mountain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lua-mountain/pkg/filesystem"
+	"lua-mountain/pkg/storage"
+)
+
+// TestPartialGroup - groups with unknown or forward referenced members are not served
+func TestPartialGroup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	st, err := filesystem.NewStorage(filesystem.WithStorageConfig(&filesystem.StorageConfig{Dir: t.TempDir(), Logger: logger}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, err := New(ctx, &Config{
+		Repositories: []RepositoryConfig{
+			{Prefix: "/internal", Storage: "rocks"},
+			{Prefix: "/vendored", Storage: "rocks"},
+			{Prefix: "/all", Members: []string{"/internal", "/vendored"}},
+			{Prefix: "/missing", Members: []string{"/internal", "/unknown"}},
+			{Prefix: "/forward", Members: []string{"/internal", "/later"}},
+			{Prefix: "/later", Members: []string{"/vendored"}},
+			{Prefix: "/nested", Members: []string{"/all", "/missing"}},
+		},
+		Storages: map[string]storage.Storage{"rocks": st},
+	}, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		prefix string
+		status int
+	}{
+		{"/internal", http.StatusOK},
+		{"/all", http.StatusOK},
+		{"/later", http.StatusOK},
+		{"/missing", http.StatusNotFound},
+		{"/forward", http.StatusNotFound},
+		// a member is not served, so a group is not served too
+		{"/nested", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.prefix+"/manifest", nil))
+			if rec.Code != tt.status {
+				t.Errorf("got %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package mountain
+
+import (
+	"lua-mountain/internal/mountain/auth"
+	"lua-mountain/internal/mountain/repository"
+)
+
+type (
+	RepositoryConfig    = repository.Config
+	UpstreamConfig      = repository.UpstreamConfig
+	LuaVersion          = repository.LuaVersion
+	ManifestCacheConfig = repository.ManifestCacheConfig
+
+	AuthConfig       = auth.Config
+	TokensConfig     = auth.TokensConfig
+	JWTConfig        = auth.JWTConfig
+	JWTRule          = auth.JWTRule
+	ClientCertConfig = auth.ClientCertConfig
+	ClientCertRule   = auth.ClientCertRule
+	HtpasswdConfig   = auth.HtpasswdConfig
+
+	// Authenticator - checks request credentials, see WithAuthenticator
+	Authenticator = auth.Authenticator
+	Principal     = auth.Principal
+	Permission    = auth.Permission
+	Operation     = auth.Operation
+)
+
+const (
+	OpRead        = auth.OpRead
+	OpPut         = auth.OpPut
+	OpDelete      = auth.OpDelete
+	OpAll         = auth.OpAll
+	AnyRepository = auth.AnyRepository
+)
+
+var (
+	// ErrNoCredentials - an authenticator does not recognize credentials of a request, next one is tried
+	ErrNoCredentials = auth.ErrNoCredentials
+	// ErrInvalidCredentials - credentials are recognized, but they are wrong, a request is rejected
+	ErrInvalidCredentials = auth.ErrInvalidCredentials
+
+	ParsePermission = auth.ParsePermission
+)
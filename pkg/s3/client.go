@@ -0,0 +1,290 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"lua-mountain/pkg/slogan"
+)
+
+const (
+	DefaultClientTimeout = time.Second * 30
+	DefaultRegion        = "us-east-1"
+	maxErrorBodySize     = 1 << 16
+)
+
+type (
+	HTTPClientConfig struct {
+		Endpoint       string
+		Region         string
+		Bucket         string
+		AccessKey      string
+		SecretKey      string
+		ForcePathStyle bool
+		Timeout        time.Duration
+		Logger         *slog.Logger
+	}
+
+	// HTTPClient - minimal needed s3 http client, works with a single bucket
+	HTTPClient struct {
+		*http.Client
+		Url            *url.URL
+		Bucket         string
+		ForcePathStyle bool
+		RequestTimeout time.Duration
+		signer         *Signer
+		logger         *slog.Logger
+	}
+)
+
+func NewHTTPClient(cfg *HTTPClientConfig) (*HTTPClient, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 client: bucket is required")
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3 client: bad endpoint %s", endpoint)
+	}
+
+	client := HTTPClient{
+		Url:            u,
+		Client:         &http.Client{},
+		Bucket:         cfg.Bucket,
+		ForcePathStyle: cfg.ForcePathStyle,
+		signer: &Signer{
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			Region:    region,
+		},
+	}
+
+	if cfg.Timeout == 0 {
+		client.RequestTimeout = DefaultClientTimeout
+	} else {
+		client.RequestTimeout = cfg.Timeout
+	}
+
+	if cfg.Logger != nil {
+		client.logger = cfg.Logger
+	} else {
+		client.logger = slog.Default()
+	}
+
+	return &client, nil
+}
+
+// GetObject - returns an object body, caller must close it
+func (hc *HTTPClient) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, hc.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("GetObject build request err: %w", err)
+	}
+
+	resp, err := hc.doRequest(ctx, req, emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("GetObject http req err: %w", err)
+	}
+
+	return resp.Body, nil
+}
+
+// HeadObject - checks an object existence
+func (hc *HTTPClient) HeadObject(ctx context.Context, key string) error {
+	req, err := http.NewRequest(http.MethodHead, hc.objectURL(key).String(), nil)
+	if err != nil {
+		return fmt.Errorf("HeadObject build request err: %w", err)
+	}
+
+	tCtx, done := context.WithTimeout(ctx, hc.RequestTimeout)
+	defer done()
+
+	resp, err := hc.doRequest(tCtx, req, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("HeadObject http req err: %w", err)
+	}
+
+	defer resp.Body.Close()
+	return nil
+}
+
+// PutObject - uploads an object, s3 requires known content length, so size must be exact
+func (hc *HTTPClient) PutObject(ctx context.Context, key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, hc.objectURL(key).String(), r)
+	if err != nil {
+		return fmt.Errorf("PutObject build request err: %w", err)
+	}
+
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	resp, err := hc.doRequest(ctx, req, UnsignedPayload)
+	if err != nil {
+		return fmt.Errorf("PutObject http req err: %w", err)
+	}
+
+	defer resp.Body.Close()
+	return nil
+}
+
+// DeleteObject - deletes an object, s3 does not fail on missing keys
+func (hc *HTTPClient) DeleteObject(ctx context.Context, key string) error {
+	req, err := http.NewRequest(http.MethodDelete, hc.objectURL(key).String(), nil)
+	if err != nil {
+		return fmt.Errorf("DeleteObject build request err: %w", err)
+	}
+
+	tCtx, done := context.WithTimeout(ctx, hc.RequestTimeout)
+	defer done()
+
+	resp, err := hc.doRequest(tCtx, req, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("DeleteObject http req err: %w", err)
+	}
+
+	defer resp.Body.Close()
+	return nil
+}
+
+// ListObjects - single page of ListObjectsV2 request, empty nextToken means first page
+func (hc *HTTPClient) ListObjects(ctx context.Context, prefix, delimiter, nextToken string) (*ListBucketResult, error) {
+	u := hc.bucketURL()
+	q := u.Query()
+	q.Set("list-type", "2")
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+
+	if delimiter != "" {
+		q.Set("delimiter", delimiter)
+	}
+
+	if nextToken != "" {
+		q.Set("continuation-token", nextToken)
+	}
+	u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("ListObjects build request err: %w", err)
+	}
+
+	tCtx, done := context.WithTimeout(ctx, hc.RequestTimeout)
+	defer done()
+
+	resp, err := hc.doRequest(tCtx, req, emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("ListObjects http req err: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	var result ListBucketResult
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ListObjects response decode err: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (hc *HTTPClient) bucketURL() *url.URL {
+	u := *hc.Url
+	if hc.ForcePathStyle {
+		u.Path = "/" + hc.Bucket + "/"
+		u.RawPath = ""
+	} else {
+		u.Host = hc.Bucket + "." + u.Host
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	return &u
+}
+
+func (hc *HTTPClient) objectURL(key string) *url.URL {
+	u := hc.bucketURL()
+	u.Path += key
+	u.RawPath = escapePath(u.Path)
+
+	return u
+}
+
+func (hc *HTTPClient) doRequest(ctx context.Context, req *http.Request, payloadHash string) (*http.Response, error) {
+	start := time.Now()
+	req = req.WithContext(ctx)
+	hc.signer.Sign(req, payloadHash, start)
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		hc.logger.DebugContext(ctx, "http request error",
+			slog.String("method", req.Method),
+			slogan.SanitizedURL("addr", req.URL),
+			slog.String("err", err.Error()),
+			slog.Duration("dur", time.Since(start)),
+		)
+		return nil, err
+	}
+
+	hc.logger.DebugContext(ctx, "http request end",
+		slog.String("method", req.Method),
+		slogan.SanitizedURL("addr", req.URL),
+		slog.String("status", resp.Status),
+		slog.Duration("dur", time.Since(start)),
+	)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	errResp := &ErrorResponse{StatusCode: resp.StatusCode}
+	if resp.Request.Method != http.MethodHead {
+		// body may be empty or not an xml, status code is enough in that case
+		_ = xml.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(errResp)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", errResp, os.ErrNotExist)
+	}
+
+	return errResp
+}
+
+// escapePath - escapes every path segment by rfc3986 rules, slashes are kept
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type (
+	Object struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	}
+
+	// ListBucketResult - response body of ListObjectsV2 request
+	ListBucketResult struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string   `xml:"Name"`
+		Prefix                string   `xml:"Prefix"`
+		KeyCount              int      `xml:"KeyCount"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		Contents              []Object `xml:"Contents"`
+		NextContinuationToken string   `xml:"NextContinuationToken"`
+	}
+
+	// ErrorResponse - s3 error body, returned with non 2xx status codes
+	ErrorResponse struct {
+		XMLName    xml.Name `xml:"Error"`
+		Code       string   `xml:"Code"`
+		Message    string   `xml:"Message"`
+		Resource   string   `xml:"Resource"`
+		RequestId  string   `xml:"RequestId"`
+		StatusCode int      `xml:"-"`
+	}
+)
+
+func (er *ErrorResponse) Error() string {
+	if er.Code == "" {
+		return fmt.Sprintf("s3 response status %d", er.StatusCode)
+	}
+
+	return fmt.Sprintf("s3 response status %d: %s: %s", er.StatusCode, er.Code, er.Message)
+}
@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm    = "AWS4-HMAC-SHA256"
+	signService      = "s3"
+	amzDateFormat    = "20060102T150405Z"
+	amzShortFormat   = "20060102"
+	UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type (
+	// Signer - signs http requests with AWS Signature Version 4
+	Signer struct {
+		AccessKey string
+		SecretKey string
+		Region    string
+	}
+)
+
+// Sign - adds x-amz-* and Authorization headers to a request.
+// payloadHash must be a hex encoded sha256 of a body or UnsignedPayload
+func (s *Signer) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if s.AccessKey == "" {
+		// anonymous access, public buckets
+		return
+	}
+
+	var (
+		scope            = strings.Join([]string{now.Format(amzShortFormat), s.Region, signService, "aws4_request"}, "/")
+		headers, signed  = canonicalHeaders(req)
+		canonicalRequest = strings.Join([]string{
+			req.Method,
+			canonicalURI(req.URL),
+			canonicalQuery(req.URL),
+			headers,
+			signed,
+			payloadHash,
+		}, "\n")
+		stringToSign = strings.Join([]string{
+			signAlgorithm,
+			amzDate,
+			scope,
+			hexSHA256([]byte(canonicalRequest)),
+		}, "\n")
+	)
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), []byte(now.Format(amzShortFormat)))
+	key = hmacSHA256(key, []byte(s.Region))
+	key = hmacSHA256(key, []byte(signService))
+	key = hmacSHA256(key, []byte("aws4_request"))
+
+	req.Header.Set("Authorization", signAlgorithm+
+		" Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+
+		", Signature="+hex.EncodeToString(hmacSHA256(key, []byte(stringToSign))),
+	)
+}
+
+func canonicalURI(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+
+	return p
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaders(req *http.Request) (string, string) {
+	var (
+		names  = []string{"host"}
+		values = map[string]string{"host": req.URL.Host}
+	)
+
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk != "content-type" && lk != "content-md5" && !strings.HasPrefix(lk, "x-amz-") {
+			continue
+		}
+
+		names = append(names, lk)
+		values[lk] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(values[name])
+		b.WriteByte('\n')
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+// escape - rfc3986 escaping, as required by aws
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,188 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"lua-mountain/pkg/option"
+)
+
+type (
+	StorageConfig struct {
+		// Prefix - optional key prefix inside a bucket, all objects are stored under it
+		Prefix string
+	}
+
+	Storage struct {
+		Client *HTTPClient
+		logger *slog.Logger
+		prefix string
+	}
+
+	// lener - readers with known remaining length, like bytes.Reader or strings.Reader
+	lener interface {
+		Len() int
+	}
+
+	// sizer - readers with known total size, like io.SectionReader
+	sizer interface {
+		io.Seeker
+		Size() int64
+	}
+)
+
+func WithStorageLogger(l *slog.Logger) option.ErrOption[*Storage] {
+	return func(s *Storage) error {
+		s.logger = l
+		return nil
+	}
+}
+
+func WithStorageConfig(cfg StorageConfig) option.ErrOption[*Storage] {
+	return func(s *Storage) error {
+		s.prefix = strings.Trim(cfg.Prefix, "/")
+		if s.prefix != "" {
+			s.prefix += "/"
+		}
+		return nil
+	}
+}
+
+func NewStorage(ctx context.Context, client *HTTPClient, opts ...option.ErrOption[*Storage]) (*Storage, error) {
+	if client == nil {
+		return nil, errors.New("storage: s3 client is required")
+	}
+
+	s := &Storage{Client: client}
+	var err error
+	for _, opt := range opts {
+		if err = opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+
+	// checks bucket availability and credentials
+	if _, err = s.Client.ListObjects(ctx, s.prefix, "/", ""); err != nil {
+		return nil, fmt.Errorf("storage: unable to list bucket %s: %w", s.Client.Bucket, err)
+	}
+
+	return s, nil
+}
+
+func (s *Storage) Get(ctx context.Context, filename string) (io.ReadCloser, error) {
+	body, err := s.Client.GetObject(ctx, s.key(filename))
+	if err != nil {
+		return nil, fmt.Errorf("storage.Get(): %w", err)
+	}
+
+	return body, nil
+}
+
+// Exists - checks object existence by HEAD request
+func (s *Storage) Exists(ctx context.Context, filename string) error {
+	if err := s.Client.HeadObject(ctx, s.key(filename)); err != nil {
+		return fmt.Errorf("storage.Exists(): %w", err)
+	}
+
+	return nil
+}
+
+// Put - saves an object. When a reader length is unknown, content is buffered in a temporary file,
+// because s3 does not accept uploads without Content-Length
+func (s *Storage) Put(ctx context.Context, filename string, r io.Reader) error {
+	var size int64
+	switch body := r.(type) {
+	case lener:
+		size = int64(body.Len())
+	case sizer:
+		offset, err := body.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("storage.Put() - unable to get body offset: %w", err)
+		}
+		size = body.Size() - offset
+	default:
+		tmp, err := os.CreateTemp("", "mountain-s3-*")
+		if err != nil {
+			return fmt.Errorf("storage.Put() - unable to create buffer file: %w", err)
+		}
+
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+
+		if size, err = io.Copy(tmp, r); err != nil {
+			return fmt.Errorf("storage.Put() - unable to buffer body: %w", err)
+		}
+
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("storage.Put() - unable to rewind buffer: %w", err)
+		}
+
+		r = tmp
+	}
+
+	s.logger.DebugContext(ctx, "s3.Storage:Put()",
+		slog.String("key", s.key(filename)),
+		slog.Int64("size", size),
+	)
+
+	if err := s.Client.PutObject(ctx, s.key(filename), r, size); err != nil {
+		return fmt.Errorf("storage.Put() - %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, filename string) error {
+	if err := s.Client.DeleteObject(ctx, s.key(filename)); err != nil {
+		return fmt.Errorf("storage.Delete() - %w", err)
+	}
+
+	return nil
+}
+
+// List - returns all object names under the prefix, nested "directories" are skipped
+func (s *Storage) List(ctx context.Context) ([]string, error) {
+	var (
+		token string
+		files = make([]string, 0, 100)
+	)
+
+	for {
+		l, err := s.Client.ListObjects(ctx, s.prefix, "/", token)
+		if err != nil {
+			return nil, fmt.Errorf("storage.List() - %w", err)
+		}
+
+		for _, object := range l.Contents {
+			name := strings.TrimPrefix(object.Key, s.prefix)
+			if name == "" {
+				continue
+			}
+
+			files = append(files, name)
+		}
+
+		if !l.IsTruncated || l.NextContinuationToken == "" {
+			break
+		}
+
+		token = l.NextContinuationToken
+	}
+
+	return files, nil
+}
+
+func (s *Storage) key(filename string) string {
+	return s.prefix + filename
+}
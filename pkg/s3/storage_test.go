@@ -0,0 +1,273 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testBucket    = "rocks"
+	testAccessKey = "AKIDEXAMPLE"
+	// testPageSize - small pages, so lists of tests are paginated
+	testPageSize = 2
+)
+
+// fakeS3 - an in-memory bucket, which serves path style requests of a single bucket
+type fakeS3 struct {
+	t       *testing.T
+	mut     sync.Mutex
+	objects map[string][]byte
+	// lists - a number of served ListObjectsV2 pages
+	lists int
+}
+
+func newFakeS3(t *testing.T, keys ...string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{t: t, objects: make(map[string][]byte, len(keys))}
+	for _, key := range keys {
+		f.objects[key] = []byte(key)
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.checkSignature(r)
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		f.error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		body, ok := f.objects[key]
+		if !ok {
+			f.error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+	case r.Method == http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(body)) != r.ContentLength {
+			f.error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		f.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// checkSignature - requests must be signed by SigV4 with a date and a payload hash
+func (f *fakeS3) checkSignature(r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, signAlgorithm+" Credential="+testAccessKey+"/") {
+		f.t.Errorf("%s %s: unexpected authorization %q", r.Method, r.URL, auth)
+	}
+
+	for _, part := range []string{"SignedHeaders=", "x-amz-content-sha256", "x-amz-date", "Signature="} {
+		if !strings.Contains(auth, part) {
+			f.t.Errorf("%s %s: authorization has no %s: %q", r.Method, r.URL, part, auth)
+		}
+	}
+
+	for _, header := range []string{"X-Amz-Date", "X-Amz-Content-Sha256"} {
+		if r.Header.Get(header) == "" {
+			f.t.Errorf("%s %s: %s header is missing", r.Method, r.URL, header)
+		}
+	}
+}
+
+// list - ListObjectsV2, a continuation token is a last key of a previous page
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("list-type") != "2" {
+		f.error(w, r, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	f.lists++
+	prefix, delimiter, token := q.Get("prefix"), q.Get("delimiter"), q.Get("continuation-token")
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || key <= token || delimiter != "" && strings.Contains(rest, delimiter) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	result := ListBucketResult{Name: testBucket, Prefix: prefix}
+	if len(keys) > testPageSize {
+		keys = keys[:testPageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	for _, key := range keys {
+		result.Contents = append(result.Contents, Object{Key: key, Size: int64(len(f.objects[key]))})
+	}
+
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_ = xml.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: code, Resource: r.URL.Path})
+	}
+}
+
+func newTestStorage(t *testing.T, srv *httptest.Server, prefix string) *Storage {
+	client, err := NewHTTPClient(&HTTPClientConfig{
+		Endpoint:       srv.URL,
+		Bucket:         testBucket,
+		AccessKey:      testAccessKey,
+		SecretKey:      "secret",
+		ForcePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	s, err := NewStorage(context.Background(), client, WithStorageConfig(StorageConfig{Prefix: prefix}))
+	if err != nil {
+		t.Fatalf("storage err: %v", err)
+	}
+
+	return s
+}
+
+func TestStorageList(t *testing.T) {
+	f, srv := newFakeS3(t,
+		"other-1.0-1.rockspec",
+		"rocks/a-1.0-1.rockspec",
+		"rocks/b-1.0-1.rockspec",
+		"rocks/b-1.0-1.src.rock",
+		"rocks/c-2.0-1.rockspec",
+		"rocks/d-3.0-1.all.rock",
+		// nested "directories" are skipped
+		"rocks/nested/e-1.0-1.rockspec",
+		"rocksx/f-1.0-1.rockspec",
+	)
+	s := newTestStorage(t, srv, "/rocks/")
+
+	f.lists = 0
+	files, err := s.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	want := []string{
+		"a-1.0-1.rockspec",
+		"b-1.0-1.rockspec",
+		"b-1.0-1.src.rock",
+		"c-2.0-1.rockspec",
+		"d-3.0-1.all.rock",
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("got %q, want %q", files, want)
+	}
+
+	if f.lists != 3 {
+		t.Errorf("got %d list pages, want 3", f.lists)
+	}
+}
+
+func TestStorageNotExist(t *testing.T) {
+	_, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "rocks")
+
+	if _, err := s.Get(context.Background(), "a-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get: got %v, want os.ErrNotExist", err)
+	}
+
+	if err := s.Exists(context.Background(), "a-1.0-1.rockspec"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Exists: got %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestStoragePutDelete(t *testing.T) {
+	f, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "rocks")
+	ctx := context.Background()
+	content := "package = \"a\"\nversion = \"1.0-1\"\n"
+
+	tests := []struct {
+		name string
+		body io.Reader
+		want string
+	}{
+		{"a-1.0-1.rockspec", strings.NewReader(content), content},
+		// a length of a reader is unknown, a body is buffered
+		{"b-1.0-1.rockspec", io.MultiReader(strings.NewReader(content)), content},
+		{"c-1.0-1.rockspec", strings.NewReader(""), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Put(ctx, tt.name, tt.body); err != nil {
+				t.Fatalf("Put: unexpected err: %v", err)
+			}
+
+			if err := s.Exists(ctx, tt.name); err != nil {
+				t.Fatalf("Exists: unexpected err: %v", err)
+			}
+
+			body, err := s.Get(ctx, tt.name)
+			if err != nil {
+				t.Fatalf("Get: unexpected err: %v", err)
+			}
+
+			got, err := io.ReadAll(body)
+			body.Close()
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Get: got %q, %v, want %q", got, err, tt.want)
+			}
+
+			f.mut.Lock()
+			_, ok := f.objects["rocks/"+tt.name]
+			f.mut.Unlock()
+			if !ok {
+				t.Errorf("object rocks/%s is not stored", tt.name)
+			}
+
+			if err = s.Delete(ctx, tt.name); err != nil {
+				t.Fatalf("Delete: unexpected err: %v", err)
+			}
+
+			if err = s.Exists(ctx, tt.name); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Exists after Delete: got %v, want os.ErrNotExist", err)
+			}
+		})
+	}
+}
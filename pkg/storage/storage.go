@@ -0,0 +1,259 @@
+// Package storage - registry of storage drivers. A driver is selected by a type key of a storage config section:
+//
+//	storages:
+//	  rocks:
+//	    type: fs
+//	    dir: /var/mountain
+//
+// Other keys of a section are decoded into a typed config of a driver. Drivers are registered by
+// Register, usually from init of a package, which implements a backend.
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// TypeKey - a config key, which selects a driver
+	TypeKey = "type"
+)
+
+type (
+	Storage interface {
+		Get(ctx context.Context, filename string) (io.ReadCloser, error)
+		Exists(ctx context.Context, filename string) error
+		Put(ctx context.Context, filename string, r io.Reader) error
+		Delete(ctx context.Context, filename string) error
+		List(ctx context.Context) ([]string, error)
+	}
+
+	// Creator - an optional Storage extension, which stores a file only if it is absent.
+	// A check and a write are atomic, an error wraps os.ErrExist, when a file exists
+	Creator interface {
+		Create(ctx context.Context, filename string, r io.Reader) error
+	}
+
+	// Notifier - an optional Storage extension, which reports files changed out of a storage,
+	// like files copied into a storage dir by other tools. A callback is called for each changed name,
+	// until ctx is done. Storages outlive config reloads, so callbacks must not be kept after it
+	Notifier interface {
+		OnChange(ctx context.Context, fn func(filename string))
+	}
+
+	// Config - a typed driver config with yaml tags
+	Config interface {
+		// Validate - checks a config after decoding, defaults are already set
+		Validate() error
+	}
+
+	Driver interface {
+		// NewConfig - returns a pointer to a config with defaults, a config section is decoded into it
+		NewConfig() Config
+		// Open - creates a storage by a validated config. Background goroutines of a storage must stop,
+		// when ctx is done: a storage is removed by a config reload or a server is stopped
+		Open(ctx context.Context, name string, cfg Config, logger *slog.Logger) (Storage, error)
+	}
+
+	// Duration - a duration of a driver config, it's set as 10s or as integer nanoseconds
+	Duration time.Duration
+
+	// Expectation - an expected content of a stored file, see WithExpectation.
+	// Storages, which support it, check a content before a file becomes visible
+	Expectation struct {
+		Size int64
+		// SHA256 - hex encoded sum
+		SHA256 string
+	}
+
+	expectationKey struct{}
+
+	typedDriver[C Config] struct {
+		newConfig func() C
+		open      func(ctx context.Context, name string, cfg C, logger *slog.Logger) (Storage, error)
+	}
+)
+
+var (
+	ErrUnexpectedContent = errors.New("content does not match expectation")
+
+	mut     sync.RWMutex
+	drivers = make(map[string]Driver)
+)
+
+// NewDriver - makes a driver of a typed config constructor and a typed open function
+func NewDriver[C Config](
+	newConfig func() C,
+	open func(ctx context.Context, name string, cfg C, logger *slog.Logger) (Storage, error),
+) Driver {
+	return &typedDriver[C]{newConfig: newConfig, open: open}
+}
+
+func (d *typedDriver[C]) NewConfig() Config {
+	return d.newConfig()
+}
+
+func (d *typedDriver[C]) Open(ctx context.Context, name string, cfg Config, logger *slog.Logger) (Storage, error) {
+	typed, ok := cfg.(C)
+	if !ok {
+		return nil, fmt.Errorf("storage %s: unexpected config type %T", name, cfg)
+	}
+
+	return d.open(ctx, name, typed, logger)
+}
+
+// Register - makes a driver available by a type name, it panics, when a name is already registered
+func Register(name string, driver Driver) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	if driver == nil {
+		panic("storage: Register driver is nil")
+	}
+
+	if _, ok := drivers[name]; ok {
+		panic("storage: Register called twice for driver " + name)
+	}
+
+	drivers[name] = driver
+}
+
+func Lookup(name string) (Driver, bool) {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	driver, ok := drivers[name]
+	return driver, ok
+}
+
+// Drivers - sorted names of registered drivers
+func Drivers() []string {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	names := maps.Keys(drivers)
+	slices.Sort(names)
+	return names
+}
+
+// DriverOf - returns a driver of a config section by its type key
+func DriverOf(section map[string]any) (Driver, error) {
+	t, ok := section[TypeKey].(string)
+	if !ok || t == "" {
+		return nil, fmt.Errorf("%s is required", TypeKey)
+	}
+
+	driver, ok := Lookup(t)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %q, supported are %s", t, strings.Join(Drivers(), ", "))
+	}
+
+	return driver, nil
+}
+
+// Decode - decodes a config section into a driver config and validates it.
+// Values are decoded by yaml rules, so durations may be set as 10s or as integer nanoseconds
+func Decode(driver Driver, section map[string]any) (Config, error) {
+	values := maps.Clone(section)
+	delete(values, TypeKey)
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("config encode err: %w", err)
+	}
+
+	cfg := driver.NewConfig()
+	if err = yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("config decode err: %w", err)
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Open - creates a storage by a config section
+func Open(ctx context.Context, name string, section map[string]any, logger *slog.Logger) (Storage, error) {
+	driver, err := DriverOf(section)
+	if err != nil {
+		return nil, fmt.Errorf("storage %s: %w", name, err)
+	}
+
+	cfg, err := Decode(driver, section)
+	if err != nil {
+		return nil, fmt.Errorf("storage %s: %w", name, err)
+	}
+
+	return driver.Open(ctx, name, cfg, logger)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return errors.New("a duration is expected")
+	}
+
+	if n, err := strconv.ParseInt(node.Value, 10, 64); err == nil {
+		*d = Duration(n)
+		return nil
+	}
+
+	dur, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("bad duration %q", node.Value)
+	}
+
+	*d = Duration(dur)
+	return nil
+}
+
+// CheckURL - checks an http or https url of a driver config, like an address of a remote storage
+func CheckURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return errors.New("bad url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New("http or https url is expected")
+	}
+
+	return nil
+}
+
+// WithExpectation - sets an expected content of a file, which is stored by ctx
+func WithExpectation(ctx context.Context, exp Expectation) context.Context {
+	return context.WithValue(ctx, expectationKey{}, exp)
+}
+
+func ExpectationFrom(ctx context.Context) (Expectation, bool) {
+	exp, ok := ctx.Value(expectationKey{}).(Expectation)
+	return exp, ok
+}
+
+// Check - compares a stored size and a sha256 sum with expected ones, zero values are not checked
+func (exp Expectation) Check(size int64, sha256sum []byte) error {
+	if exp.Size > 0 && exp.Size != size {
+		return fmt.Errorf("size %d, expected %d: %w", size, exp.Size, ErrUnexpectedContent)
+	}
+
+	if exp.SHA256 != "" && !strings.EqualFold(exp.SHA256, hex.EncodeToString(sha256sum)) {
+		return fmt.Errorf("sha256 %x, expected %s: %w", sha256sum, exp.SHA256, ErrUnexpectedContent)
+	}
+
+	return nil
+}